@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
+	"regexp"
+	"time"
 
 	"github.com/barnettzqg/gomig/db/common"
 	"github.com/go-yaml/yaml"
@@ -23,19 +25,144 @@ type ProjectionConfig struct {
 	Engine     string            `yaml:"engine,omitempty"`
 }
 
+const (
+	/* how the names of tables and columns are turned into destination
+	 * identifiers */
+	NamingLowercase = "lowercase"
+	NamingPreserve  = "preserve"
+	NamingSnakeCase = "snake_case"
+)
+
+//TableConfig TableConfig
+type TableConfig struct {
+	ZeroDates      string                  `yaml:"zero_dates,omitempty"`
+	InvalidJson    string                  `yaml:"invalid_json,omitempty"`
+	Sanitize       string                  `yaml:"sanitize,omitempty"`
+	RepairEncoding bool                    `yaml:"repair_encoding,omitempty"`
+	Columns        map[string]ColumnConfig `yaml:"columns,omitempty"`
+
+	/* an SQL condition of the source, only the rows that match it are
+	 * migrated */
+	Where string `yaml:"where,omitempty"`
+
+	/* columns that only exist in the destination */
+	AddColumns []AddColumnConfig `yaml:"add_columns,omitempty"`
+}
+
+//ColumnConfig ColumnConfig
+type ColumnConfig struct {
+	ZeroDates      string `yaml:"zero_dates,omitempty"`
+	RepairEncoding bool   `yaml:"repair_encoding,omitempty"`
+
+	/* the name of the column in the destination, overrides the naming
+	 * policy */
+	Rename string `yaml:"rename,omitempty"`
+
+	/* whether the column is left out of the destination altogether */
+	Drop bool `yaml:"drop,omitempty"`
+
+	/* an SQL expression of the source the column is read with, e.g.
+	 * HEX(uuid_bin), and the postgres type of the column, which can also
+	 * be given on its own */
+	Select string `yaml:"select,omitempty"`
+	Type   string `yaml:"type,omitempty"`
+
+	/* how the values are masked: null, constant (by mask_value), hash,
+	 * email, phone, name or shift_date */
+	Mask      string `yaml:"mask,omitempty"`
+	MaskValue string `yaml:"mask_value,omitempty"`
+}
+
+//AddColumnConfig AddColumnConfig
+type AddColumnConfig struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"` /* a postgres type */
+
+	/* either a constant value or an SQL expression evaluated by the
+	 * destination, e.g. now() */
+	Value      string `yaml:"value,omitempty"`
+	Expression string `yaml:"expression,omitempty"`
+}
+
+//TypeRule TypeRule
+type TypeRule struct {
+	/* a regular expression matched against the MySQL column type, e.g.
+	 * ^tinyint\(4\) unsigned$ */
+	Match string `yaml:"match"`
+	Type  string `yaml:"type"` /* a postgres type */
+}
+
 //Config Config
 type Config struct {
-	Mysql        *common.Config               `yaml:"mysql,omitempty"`
-	Destination  *DestinationConfig           `yaml:"destination,omitempty"`
-	Views        map[string]string            `yaml:"views,omitempty"`
-	Projections  map[string]ProjectionConfig  `yaml:"projections,omitempty"`
-	Tables       map[string]map[string]string `yaml:"tables,omitempty"`
-	TableMap     map[string]string            `yaml:"table_map,omitempty"`
-	SuppressData bool                         `yaml:"supress_data"`
-	SuppressDdl  bool                         `yaml:"supress_ddl"`
-	Truncate     bool                         `yaml:"force_truncate"`
-	Merge        bool                         `yaml:"merge"`
-	Timezone     bool                         `yaml:"timezone"`
+	Mysql        *common.Config              `yaml:"mysql,omitempty"`
+	Destination  *DestinationConfig          `yaml:"destination,omitempty"`
+	Views        map[string]string           `yaml:"views,omitempty"`
+	Projections  map[string]ProjectionConfig `yaml:"projections,omitempty"`
+	Tables       map[string]TableConfig      `yaml:"tables,omitempty"`
+	TableMap     map[string]string           `yaml:"table_map,omitempty"`
+	SuppressData bool                        `yaml:"supress_data"`
+	SuppressDdl  bool                        `yaml:"supress_ddl"`
+	Truncate     bool                        `yaml:"force_truncate"`
+	Merge        bool                        `yaml:"merge"`
+	Timezone     bool                        `yaml:"timezone"`
+
+	/* the time zone DATETIME values are in, empty keeps them naive */
+	DatetimeZone string `yaml:"datetime_zone,omitempty"`
+
+	/* how destination identifiers are named: lowercase, preserve or
+	 * snake_case */
+	Naming string `yaml:"naming,omitempty"`
+
+	/* how auto-increment columns are recreated: identity or serial */
+	AutoIncrement string `yaml:"auto_increment,omitempty"`
+
+	/* name of a bigserial primary key added to tables without one */
+	SurrogateKey string `yaml:"surrogate_key,omitempty"`
+
+	/* how enum columns are recreated: type or check */
+	Enums string `yaml:"enums,omitempty"`
+
+	/* whether to scan the data of columns whose type is uncertain
+	 * (tinyint, long varchar) to pick a better type */
+	Profile bool `yaml:"profile,omitempty"`
+
+	/* whether TIME columns become interval, as MySQL allows values
+	 * outside of a day (-838:59:59 to 838:59:59) */
+	TimeAsInterval bool `yaml:"time_as_interval,omitempty"`
+
+	/* what text with a binary collation becomes: c or bytea */
+	BinaryCollation string `yaml:"binary_collation,omitempty"`
+
+	/* what text with a case-insensitive collation becomes: citext, icu
+	 * (a nondeterministic collation) or nothing special if empty */
+	CaseInsensitive string `yaml:"case_insensitive,omitempty"`
+
+	/* whether bit(1) columns become boolean instead of bit varying(1) */
+	BitAsBool bool `yaml:"bit_as_bool,omitempty"`
+
+	/* whether unsigned integer columns get a CHECK (col >= 0) */
+	UnsignedCheck bool `yaml:"unsigned_check,omitempty"`
+
+	/* what to do with zero dates: null, epoch, fail or a replacement
+	 * value, can be overridden per table and column */
+	ZeroDates string `yaml:"zero_dates,omitempty"`
+
+	/* what to do with invalid JSON documents: fail, null or wrap (store
+	 * them as a JSON string), can be overridden per table */
+	InvalidJson string `yaml:"invalid_json,omitempty"`
+
+	/* what to do with NUL bytes and invalid UTF-8 in text: replace (by
+	 * U+FFFD), strip or fail, can be overridden per table */
+	Sanitize string `yaml:"sanitize,omitempty"`
+
+	/* the secret the keyed masks of columns are derived from, the same key
+	 * gives the same masked values in every run */
+	MaskKey string `yaml:"mask_key,omitempty"`
+
+	/* postgres types for the columns whose MySQL type matches, the first
+	 * matching rule wins, the types of columns take precedence */
+	TypeRules       []TypeRule       `yaml:"type_rules,omitempty"`
+	TypeRulesRegexp []*regexp.Regexp `yaml:"-"`
 
 	/* the included and excluded tables as both a map and a list, depending
 	 * on what's most convenient. Note that the map version have last the
@@ -65,8 +192,18 @@ func LoadConfig(file string) (*Config, error) {
 		return nil, err
 	}
 
+	/* TIMESTAMP values can only be migrated as points in time if the zone
+	 * they're read in is known */
+	if c.Timezone && c.Mysql.Timezone == "" {
+		c.Mysql.Timezone = "+00:00"
+	}
+
 	c.OnlyTables = stringSliceToSet(c.OnlyTablesList)
 	c.ExcludeTables = stringSliceToSet(c.ExcludeTablesList)
+	for _, rule := range c.TypeRules {
+		/* validated already */
+		c.TypeRulesRegexp = append(c.TypeRulesRegexp, regexp.MustCompile(rule.Match))
+	}
 
 	return &c, err
 }
@@ -79,6 +216,8 @@ func stringSliceToSet(sl []string) map[string]bool {
 	return set
 }
 
+var zoneOffsetRegexp = regexp.MustCompile(`^[+-]\d{1,2}:\d{2}$`)
+
 //Validate Validate
 func (c *Config) Validate() error {
 	if c.Mysql == nil {
@@ -94,5 +233,156 @@ func (c *Config) Validate() error {
 			"the destination field of the config file: %v", c)
 	}
 
+	/* in a named zone the hour repeated when DST ends is ambiguous, so
+	 * TIMESTAMP values can't be told apart anymore */
+	if c.Timezone && c.Mysql.Timezone != "" && !zoneOffsetRegexp.MatchString(c.Mysql.Timezone) {
+		return fmt.Errorf("with timezone true, the timezone of mysql should be an offset "+
+			"such as +00:00, not %v", c.Mysql.Timezone)
+	}
+
+	switch c.Naming {
+	case "", NamingLowercase, NamingPreserve, NamingSnakeCase:
+	default:
+		return fmt.Errorf("naming should be %v, %v or %v, not %v",
+			NamingLowercase, NamingPreserve, NamingSnakeCase, c.Naming)
+	}
+
+	switch c.AutoIncrement {
+	case "", common.AutoIncrIdentity, common.AutoIncrSerial:
+	default:
+		return fmt.Errorf("auto_increment should be either %v or %v, not %v",
+			common.AutoIncrIdentity, common.AutoIncrSerial, c.AutoIncrement)
+	}
+
+	switch c.Enums {
+	case "", common.EnumAsType, common.EnumAsCheck:
+	default:
+		return fmt.Errorf("enums should be either %v or %v, not %v",
+			common.EnumAsType, common.EnumAsCheck, c.Enums)
+	}
+
+	switch c.BinaryCollation {
+	case "", common.BinaryCollationC, common.BinaryCollationBytea:
+	default:
+		return fmt.Errorf("binary_collation should be either %v or %v, not %v",
+			common.BinaryCollationC, common.BinaryCollationBytea, c.BinaryCollation)
+	}
+
+	switch c.CaseInsensitive {
+	case "", common.CaseInsensitiveCitext, common.CaseInsensitiveIcu:
+	default:
+		return fmt.Errorf("case_insensitive should be either %v or %v, not %v",
+			common.CaseInsensitiveCitext, common.CaseInsensitiveIcu, c.CaseInsensitive)
+	}
+
+	if err := validateZeroDates(c.ZeroDates); err != nil {
+		return err
+	}
+	if err := validateInvalidJson(c.InvalidJson); err != nil {
+		return err
+	}
+	if err := validateSanitize(c.Sanitize); err != nil {
+		return err
+	}
+	for _, rule := range c.TypeRules {
+		if rule.Match == "" || rule.Type == "" {
+			return fmt.Errorf("type_rules need both a match and a type")
+		}
+		if _, err := regexp.Compile(rule.Match); err != nil {
+			return fmt.Errorf("type_rules: %v", err)
+		}
+	}
+	for tname, table := range c.Tables {
+		if err := validateZeroDates(table.ZeroDates); err != nil {
+			return fmt.Errorf("table %v: %v", tname, err)
+		}
+		if err := validateInvalidJson(table.InvalidJson); err != nil {
+			return fmt.Errorf("table %v: %v", tname, err)
+		}
+		if err := validateSanitize(table.Sanitize); err != nil {
+			return fmt.Errorf("table %v: %v", tname, err)
+		}
+		for cname, col := range table.Columns {
+			if err := validateZeroDates(col.ZeroDates); err != nil {
+				return fmt.Errorf("column %v.%v: %v", tname, cname, err)
+			}
+			if col.Select != "" && col.Type == "" {
+				return fmt.Errorf("column %v.%v: select needs a type", tname, cname)
+			}
+			if err := validateMask(col.Mask, c.MaskKey); err != nil {
+				return fmt.Errorf("column %v.%v: %v", tname, cname, err)
+			}
+		}
+		for _, add := range table.AddColumns {
+			if err := validateAddColumn(add); err != nil {
+				return fmt.Errorf("table %v: %v", tname, err)
+			}
+		}
+	}
+
 	return nil
 }
+
+func validateAddColumn(add AddColumnConfig) error {
+	if add.Name == "" || add.Type == "" {
+		return fmt.Errorf("add_columns needs both a name and a type")
+	}
+	if (add.Value == "") == (add.Expression == "") {
+		return fmt.Errorf("added column %v needs either a value or an expression", add.Name)
+	}
+
+	return nil
+}
+
+func validateMask(mask string, key string) error {
+	switch mask {
+	case "", common.MaskNull, common.MaskConstant:
+		return nil
+	case common.MaskHash, common.MaskEmail, common.MaskPhone, common.MaskName, common.MaskShiftDate:
+		if key == "" {
+			return fmt.Errorf("mask %v needs a mask_key", mask)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("mask should be %v, %v, %v, %v, %v, %v or %v, not %v",
+		common.MaskNull, common.MaskConstant, common.MaskHash, common.MaskEmail,
+		common.MaskPhone, common.MaskName, common.MaskShiftDate, mask)
+}
+
+func validateInvalidJson(policy string) error {
+	switch policy {
+	case "", common.InvalidJsonFail, common.InvalidJsonNull, common.InvalidJsonWrap:
+		return nil
+	}
+
+	return fmt.Errorf("invalid_json should be %v, %v or %v, not %v",
+		common.InvalidJsonFail, common.InvalidJsonNull, common.InvalidJsonWrap, policy)
+}
+
+func validateSanitize(policy string) error {
+	switch policy {
+	case "", common.SanitizeReplace, common.SanitizeStrip, common.SanitizeFail:
+		return nil
+	}
+
+	return fmt.Errorf("sanitize should be %v, %v or %v, not %v",
+		common.SanitizeReplace, common.SanitizeStrip, common.SanitizeFail, policy)
+}
+
+/* zero_dates is either a policy or a valid replacement date */
+func validateZeroDates(policy string) error {
+	switch policy {
+	case "", common.ZeroDateNull, common.ZeroDateEpoch, common.ZeroDateFail:
+		return nil
+	}
+
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04:05"} {
+		if _, err := time.Parse(layout, policy); err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("zero_dates should be %v, %v, %v or a date (YYYY-MM-DD [HH:MM:SS]), not %v",
+		common.ZeroDateNull, common.ZeroDateEpoch, common.ZeroDateFail, policy)
+}
@@ -3,8 +3,12 @@ package main
 import (
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
+	"unicode"
 
 	"github.com/barnettzqg/gomig/db/common"
+	"github.com/barnettzqg/gomig/db/postgres"
 )
 
 var (
@@ -81,26 +85,45 @@ func Convert(r common.ReadCloser, w common.WriteCloser, options *Config, verbosi
 	 * ordering among the tables. */
 	OrderTableByNamesList(tables, options.OnlyTablesList)
 
+	/* set up how the tables are read, before any of them are */
+	for _, table := range tables {
+		applySourceOptions(table, options.Tables[table.Name])
+	}
+
 	/* override types if specified in the options */
 	for _, table := range tables {
-		/* is this table a projection? */
-		meta, ok := options.Projections[table.Name]
-		if !ok {
-			continue
-		}
 		/* see if any of the columns require a different type than the
 		 * one we derived */
 		for _, col := range table.Columns {
-			newtype, ok := meta.Types[col.Name]
+			newtype, ok := overrideType(table.Name, col, options)
 			if !ok {
 				continue
 			}
 
-			col.Type = common.SimpleType(newtype)
-			col.RawType = newtype
+			col.DstType = newtype
+			if t := postgres.PostgresToGenericType(newtype); t != nil {
+				/* convert the values as they should end up */
+				col.Type = t
+			} else if col.Select != "" {
+				/* there's no telling what the expression returns,
+				 * postgres makes sense of its text */
+				col.Type = common.DeclaredType(newtype)
+			}
 		}
 	}
 
+	applyColumnOptions(tables, options)
+	/* after the dropped columns are gone, before any DDL */
+	if options.Profile {
+		profileTables(r, tables)
+	}
+	if err := checkNames(tables, options); err != nil {
+		return err
+	}
+	if err := checkMasks(tables); err != nil {
+		return err
+	}
+
 	if !options.SuppressDdl {
 		createTables(tables, w)
 	}
@@ -108,7 +131,7 @@ func Convert(r common.ReadCloser, w common.WriteCloser, options *Config, verbosi
 		truncateTables(tables, w)
 	}
 	if !options.SuppressData {
-		var mergeTables []string
+		var mergeTables []*common.Table
 		if options.Merge {
 			for _, srcTable := range tables {
 				fmt.Println(srcTable.Name)
@@ -122,17 +145,18 @@ func Convert(r common.ReadCloser, w common.WriteCloser, options *Config, verbosi
 					log.Println("converter: merging table", srcTable.Name)
 				}
 
-				dstTableName := strmap(srcTable.Name, options.TableMap)
-				err := w.MergeTable(srcTable, dstTableName, extraDstCond, r)
+				err := w.MergeTable(srcTable, srcTable.Destination(), extraDstCond, r)
 				if err != nil {
 					w.ClearTable(mergeTables)
 					return err
 				}
-				mergeTables = append(mergeTables, srcTable.Name)
+				mergeTables = append(mergeTables, srcTable)
 			}
 		} else {
 			writeData(tables, w)
 		}
+
+		reportChanges(tables)
 	}
 
 	createIndices(tables, w)
@@ -141,16 +165,336 @@ func Convert(r common.ReadCloser, w common.WriteCloser, options *Config, verbosi
 	return nil
 }
 
-func strmap(srcname string, m map[string]string) string {
-	if m == nil {
-		return srcname
+/* the postgres type a column should have according to the options, the
+ * types of columns and projections take precedence over the type rules */
+func overrideType(table string, col *common.Column, options *Config) (string, bool) {
+	if newtype := options.Tables[table].Columns[col.Name].Type; newtype != "" {
+		return newtype, true
+	}
+	if newtype, ok := options.Projections[table].Types[col.Name]; ok {
+		return newtype, true
+	}
+	for i, rule := range options.TypeRules {
+		if options.TypeRulesRegexp[i].MatchString(col.RawType) {
+			return rule.Type, true
+		}
+	}
+
+	return "", false
+}
+
+/* the settings that change what is read from the source: the row filter
+ * and the column expressions */
+func applySourceOptions(table *common.Table, tconf TableConfig) {
+	table.Where = tconf.Where
+	for _, col := range table.Columns {
+		cconf := tconf.Columns[col.Name]
+		if cconf.Select != "" {
+			col.Select = cconf.Select
+			/* the expression can give NULL whatever the column allows */
+			col.Null = true
+		}
+	}
+}
+
+/* copies the global table and column settings from the config onto the
+ * tables and their columns, per table and per column settings take
+ * precedence */
+func applyColumnOptions(tables []*common.Table, options *Config) {
+	for _, table := range tables {
+		tconf := options.Tables[table.Name]
+		table.DstSchema, table.DstName = dstTableName(table.Name, options)
+		dropColumns(table, tconf)
+		for _, add := range tconf.AddColumns {
+			dflt := add.Expression
+			if dflt == "" {
+				dflt = "'" + strings.Replace(add.Value, "'", "''", -1) + "'"
+			}
+			table.Added = append(table.Added, &common.AddedColumn{
+				Name: add.Name, Type: add.Type, Default: dflt})
+		}
+
+		hasPk := false
+		for _, col := range table.Columns {
+			cconf := tconf.Columns[col.Name]
+			col.DstName = applyNaming(col.Name, options.Naming)
+			if cconf.Rename != "" {
+				col.DstName = cconf.Rename
+			}
+			col.ZeroDate = firstNonEmpty(cconf.ZeroDates, tconf.ZeroDates, options.ZeroDates)
+			col.InvalidJson = firstNonEmpty(tconf.InvalidJson, options.InvalidJson)
+			col.Sanitize = firstNonEmpty(tconf.Sanitize, options.Sanitize)
+			col.RepairEncoding = tconf.RepairEncoding || cconf.RepairEncoding
+			col.Mask = cconf.Mask
+			col.MaskValue = cconf.MaskValue
+			col.MaskKey = options.MaskKey
+			if col.Mask == common.MaskNull {
+				col.Null = true
+			}
+
+			if col.AutoIncr {
+				col.AutoIncrStyle = options.AutoIncrement
+			}
+			if col.Type.Name == common.TypeEnum {
+				col.EnumStyle = options.Enums
+			}
+			col.CheckUnsigned = options.UnsignedCheck
+			if col.DstType == "" {
+				applyTypeOptions(col, options)
+			} else if col.Type.Name == common.TypeTimeStampTz && col.Zone == "" {
+				/* a DATETIME declared as timestamptz */
+				col.Zone = options.DatetimeZone
+			}
+			hasPk = hasPk || col.PrimaryKey
+		}
+
+		if !hasPk {
+			table.SurrogateKey = options.SurrogateKey
+		}
+	}
+}
+
+/* the global settings that change the type of a column, a type declared
+ * in the config is left alone */
+func applyTypeOptions(col *common.Column, options *Config) {
+	if options.BitAsBool && col.Type.Name == common.TypeBit && col.Type.Max == 1 {
+		col.Type = common.BoolType()
+	}
+	if options.TimeAsInterval && col.Type.Name == common.TypeTime {
+		col.Type = common.IntervalType()
+	}
+	applyCollation(col, options)
+
+	/* TIMESTAMP is only migrated as an absolute point in time if asked
+	 * to, DATETIME only if we know its zone */
+	switch col.Type.Name {
+	case common.TypeTimeStampTz:
+		if !options.Timezone {
+			col.Type.Name = common.TypeTimeStamp
+		}
+	case common.TypeTimeStamp:
+		if options.DatetimeZone != "" {
+			col.Type.Name = common.TypeTimeStampTz
+			col.Zone = options.DatetimeZone
+		}
+	}
+}
+
+/* removes the dropped columns from the table, along with the indexes
+ * that cover them */
+func dropColumns(table *common.Table, tconf TableConfig) {
+	for name, cconf := range tconf.Columns {
+		if cconf.Drop && table.Column(name) == nil {
+			log.Printf("converter: WARNING: can't drop %v.%v, no such column\n", table.Name, name)
+		}
+	}
+
+	cols := table.Columns[:0]
+	for _, col := range table.Columns {
+		if !tconf.Columns[col.Name].Drop {
+			cols = append(cols, col)
+		}
+	}
+	table.Columns = cols
+
+	indexes := table.Indexes[:0]
+IndexLoop:
+	for _, idx := range table.Indexes {
+		for _, name := range idx.Columns {
+			if table.Column(name) == nil {
+				log.Printf("converter: WARNING: not recreating index %v of %v, it covers a dropped column\n",
+					idx.Name, table.Name)
+				continue IndexLoop
+			}
+		}
+		indexes = append(indexes, idx)
+	}
+	table.Indexes = indexes
+}
+
+/* decides how the collation of a text column is recreated */
+func applyCollation(col *common.Column, options *Config) {
+	if col.Type.Name != common.TypeText && col.Type.Name != common.TypeChar {
+		return
+	}
+
+	switch {
+	case strings.HasSuffix(col.Collation, "_bin"):
+		if options.BinaryCollation == common.BinaryCollationBytea {
+			col.Type = common.BlobType()
+		} else {
+			/* compares bytes, like the binary collations */
+			col.DstCollation = "C"
+		}
+	case strings.HasSuffix(col.Collation, "_ci"):
+		switch options.CaseInsensitive {
+		case common.CaseInsensitiveCitext:
+			col.Citext = true
+		case common.CaseInsensitiveIcu:
+			col.DstCollation = common.CollationCaseInsensitive
+		}
+	}
+}
+
+func firstNonEmpty(strs ...string) string {
+	for _, str := range strs {
+		if str != "" {
+			return str
+		}
+	}
+	return ""
+}
+
+/* prints how many values were changed during the transfer, per column */
+func reportChanges(tables []*common.Table) {
+	for _, table := range tables {
+		for _, col := range table.Columns {
+			for reason, count := range col.Changes {
+				log.Printf("converter: %v.%v: %v %v\n", table.Name, col.Name, count, reason)
+			}
+		}
+	}
+}
+
+/* the schema and name of a table in the destination, table_map takes
+ * precedence over the naming policy. Only table_map names can be qualified
+ * by a schema, other dots are part of the name. */
+func dstTableName(srcname string, options *Config) (string, string) {
+	if mapped, ok := options.TableMap[srcname]; ok {
+		return common.SplitQualified(mapped)
+	}
+	return "", applyNaming(srcname, options.Naming)
+}
+
+/* renames and the naming policy can map different names of the source to
+ * the same destination name (UserId and user_id both become user_id) */
+func checkNames(tables []*common.Table, options *Config) error {
+	dstTables := make(map[string]string, len(tables))
+	for _, table := range tables {
+		dst := table.Destination()
+		if table.DstSchema != "" {
+			dst = table.DstSchema + "." + dst
+		}
+		if other, ok := dstTables[dst]; ok {
+			return fmt.Errorf("converter: tables %v and %v would both become %v", other, table.Name, dst)
+		}
+		dstTables[dst] = table.Name
+
+		/* destination column name -> what it comes from */
+		dstCols := make(map[string]string, len(table.Columns))
+		claim := func(name, source string) error {
+			if other, ok := dstCols[name]; ok {
+				return fmt.Errorf("converter: %v and %v of table %v would both become column %v",
+					other, source, table.Name, name)
+			}
+			dstCols[name] = source
+			return nil
+		}
+
+		for _, col := range table.Columns {
+			if err := claim(col.Destination(), col.Name); err != nil {
+				return err
+			}
+		}
+		for _, add := range table.Added {
+			if err := claim(add.Name, "added column "+add.Name); err != nil {
+				return err
+			}
+		}
+		if table.SurrogateKey != "" {
+			if err := claim(table.SurrogateKey, "surrogate key "+table.SurrogateKey); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+/* masks only make sense for some types, and constants have to be valid
+ * values of the column as numbers and booleans are written unquoted */
+func checkMasks(tables []*common.Table) error {
+	for _, table := range tables {
+		for _, col := range table.Columns {
+			if err := checkMask(col); err != nil {
+				return fmt.Errorf("converter: %v.%v (%v): %v", table.Name, col.Name, col.RawType, err)
+			}
+		}
+	}
+	return nil
+}
+
+func checkMask(col *common.Column) error {
+	t := col.Type.Name
+	var ok bool
+	switch col.Mask {
+	case "", common.MaskNull:
+		return nil
+	case common.MaskConstant:
+		switch t {
+		case common.TypeInteger, common.TypeNumeric, common.TypeFloat, common.TypeDouble:
+			if _, err := strconv.ParseFloat(col.MaskValue, 64); err != nil {
+				return fmt.Errorf("mask_value %q isn't a number", col.MaskValue)
+			}
+		case common.TypeBool:
+			if col.MaskValue != "0" && col.MaskValue != "1" {
+				return fmt.Errorf("mask_value %q should be 0 or 1", col.MaskValue)
+			}
+		case common.TypeBit, common.TypeGeometry, common.TypeSet, common.TypeEnum, common.TypeJson:
+			return fmt.Errorf("constant masks aren't supported for this type")
+		}
+		return nil
+	case common.MaskHash:
+		ok = t == common.TypeInteger || t == common.TypeText || t == common.TypeChar || t == common.TypeBlob
+	case common.MaskEmail, common.MaskPhone, common.MaskName:
+		ok = t == common.TypeText || t == common.TypeChar
+	case common.MaskShiftDate:
+		ok = t == common.TypeDate || t == common.TypeTimeStamp || t == common.TypeTimeStampTz
 	}
-	mapped, ok := m[srcname]
+
 	if !ok {
-		return srcname
+		return fmt.Errorf("mask %v can't be used on a column of this type", col.Mask)
+	}
+	return nil
+}
+
+/* applies the naming policy to an identifier of the source */
+func applyNaming(name string, policy string) string {
+	switch policy {
+	case NamingPreserve:
+		return name
+	case NamingSnakeCase:
+		return snakeCase(name)
+	default:
+		return strings.ToLower(name)
+	}
+}
+
+/* OrderItems, orderItems and order-items all become order_items, acronyms
+ * are kept together: HTTPServer becomes http_server */
+func snakeCase(name string) string {
+	runes := []rune(name)
+	out := make([]rune, 0, len(runes)+4)
+	for i, r := range runes {
+		switch {
+		case unicode.IsUpper(r):
+			prevLower := i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]))
+			nextLower := i > 0 && i+1 < len(runes) && unicode.IsUpper(runes[i-1]) && unicode.IsLower(runes[i+1])
+			if (prevLower || nextLower) && out[len(out)-1] != '_' {
+				out = append(out, '_')
+			}
+			out = append(out, unicode.ToLower(r))
+		case unicode.IsLetter(r), unicode.IsDigit(r):
+			out = append(out, r)
+		default:
+			/* separators: spaces, hyphens, dots, ... */
+			if len(out) > 0 && out[len(out)-1] != '_' {
+				out = append(out, '_')
+			}
+		}
 	}
 
-	return mapped
+	return strings.Trim(string(out), "_")
 }
 
 func createTables(tables []*common.Table, w common.Writer) error {
@@ -10,4 +10,11 @@ type Config struct {
 	Database string `yaml:"database,omitempty"`
 	Compress bool   `yaml:"compress,omitempty"`
 	SSLmode  bool   `yaml:"sslmode,omitempty"`
+
+	/* session time zone, either a name (Europe/Brussels, needs the time
+	 * zone tables on MySQL) or an offset (+02:00), defaults to UTC */
+	Timezone string `yaml:"timezone,omitempty"`
+
+	/* connection character set, defaults to utf8mb4 */
+	Charset string `yaml:"charset,omitempty"`
 }
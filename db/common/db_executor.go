@@ -139,7 +139,7 @@ func (e *DbExecutor) Single(name string, statement string) error {
 	return e.Submit(statement)
 }
 
-func (e *DbExecutor) BulkInit(table string, columns ...string) error {
+func (e *DbExecutor) BulkInit(schema, table string, columns ...string) error {
 	return ErrCapNotSupported
 }
 
@@ -0,0 +1,56 @@
+package common
+
+import (
+	"unicode/utf8"
+)
+
+/* MySQL's latin1 is really cp1252, these are the characters it maps 0x80 -
+ * 0x9f to (the undefined ones are passed through as control characters) */
+var cp1252High = [32]rune{
+	0x20ac, 0x0081, 0x201a, 0x0192, 0x201e, 0x2026, 0x2020, 0x2021,
+	0x02c6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008d, 0x017d, 0x008f,
+	0x0090, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014,
+	0x02dc, 0x2122, 0x0161, 0x203a, 0x0153, 0x009d, 0x017e, 0x0178,
+}
+
+var cp1252Bytes = make(map[rune]byte, len(cp1252High))
+
+func init() {
+	for i, r := range cp1252High {
+		cp1252Bytes[r] = byte(0x80 + i)
+	}
+}
+
+/* undoes UTF-8 text that was stored in a latin1 column and converted to
+ * UTF-8 a second time on the way out (Ã© instead of é). Returns false, and
+ * s unchanged, if s doesn't look double-encoded. */
+func RepairDoubleEncoding(s string) (string, bool) {
+	buf := make([]byte, 0, len(s))
+	high := false
+	for _, r := range s {
+		switch {
+		case r < 0x80:
+			buf = append(buf, byte(r))
+		case r >= 0xa0 && r <= 0xff:
+			buf = append(buf, byte(r))
+			high = true
+		default:
+			b, ok := cp1252Bytes[r]
+			if !ok {
+				/* not representable in latin1, so it can't be the
+				 * result of a double encoding */
+				return s, false
+			}
+			buf = append(buf, b)
+			high = true
+		}
+	}
+
+	/* plain ASCII is the same in both encodings, and if the bytes don't
+	 * form valid UTF-8 the text was really latin1 */
+	if !high || !utf8.Valid(buf) {
+		return s, false
+	}
+
+	return string(buf), true
+}
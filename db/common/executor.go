@@ -30,8 +30,9 @@ type Executor interface {
 
 	/* bulk statements for copying large amounts of data, the underlying
 	 * implementation will try to use the most efficient way of achieving this,
-	 * for example postgres' COPY FROM semantics. */
-	BulkInit(table string, columns ...string) error
+	 * for example postgres' COPY FROM semantics. The schema is empty for
+	 * the default one. */
+	BulkInit(schema, table string, columns ...string) error
 	BulkAddRecord(args ...interface{}) error
 	BulkFinish() error
 
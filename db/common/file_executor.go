@@ -115,7 +115,7 @@ func (e *FileExecutor) Single(name string, statement string) error {
 	return err
 }
 
-func (e *FileExecutor) BulkInit(table string, columns ...string) error {
+func (e *FileExecutor) BulkInit(schema, table string, columns ...string) error {
 	return ErrCapNotSupported
 }
 
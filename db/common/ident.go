@@ -0,0 +1,27 @@
+package common
+
+import (
+	"strings"
+)
+
+/* quotes an identifier (table, column, ...) in the way the database type
+ * (mysql, postgres) expects, so reserved words, mixed case and special
+ * characters can be used */
+func QuoteIdentifier(dbType string, name string) string {
+	switch dbType {
+	case "mysql":
+		return "`" + strings.Replace(name, "`", "``", -1) + "`"
+	default:
+		/* the SQL standard */
+		return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+	}
+}
+
+/* splits a schema-qualified name (schema.table) into its parts, schema is
+ * empty if the name isn't qualified */
+func SplitQualified(name string) (schema string, table string) {
+	if i := strings.Index(name, "."); i > 0 && i < len(name)-1 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
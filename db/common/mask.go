@@ -0,0 +1,260 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var maskFirstNames = []string{
+	"Alex", "Billie", "Casey", "Dana", "Eli", "Frankie", "Gale", "Harper",
+	"Indy", "Jesse", "Kai", "Lee", "Morgan", "Noa", "Oakley", "Parker",
+	"Quinn", "Riley", "Sam", "Taylor", "Umi", "Val", "Wren", "Yael",
+}
+
+var maskLastNames = []string{
+	"Adams", "Baker", "Clark", "Davis", "Evans", "Fisher", "Garcia", "Hill",
+	"Ito", "Jones", "Kim", "Lopez", "Miller", "Novak", "Olsen", "Patel",
+	"Quist", "Reyes", "Smith", "Turner", "Ueda", "Vega", "Walker", "Young",
+}
+
+/* the domain of fake e-mail addresses, reserved for examples (RFC 2606),
+ * and the one for columns too short for it */
+const (
+	maskEmailDomain      = "example.com"
+	maskEmailShortDomain = "x.test"
+)
+
+/* dates are shifted by at most this many days */
+const maskMaxShiftDays = 365
+
+/* masks a (non-NULL) value of col according to its mask. Returns true if
+ * the value should become NULL. */
+func MaskValue(s string, col *Column) (string, bool) {
+	var masked string
+	switch col.Mask {
+	case "":
+		return s, false
+	case MaskNull:
+		col.CountChange("values masked")
+		return "", true
+	case MaskConstant:
+		masked = col.MaskValue
+	case MaskHash:
+		masked = maskHash(s, col)
+	case MaskEmail:
+		masked = maskEmail(s, col)
+	case MaskPhone:
+		masked = maskPhone(s, col.MaskKey)
+	case MaskName:
+		masked = maskName(s, col)
+	case MaskShiftDate:
+		masked = maskShiftDate(s, col.MaskKey)
+	}
+
+	if masked != s {
+		col.CountChange("values masked")
+	}
+	return masked, false
+}
+
+/* n pseudo-random bytes that only depend on the key and the input */
+func maskStream(key string, input string, n int) []byte {
+	stream := make([]byte, 0, n+sha256.Size)
+	for counter := uint32(0); len(stream) < n; counter++ {
+		mac := hmac.New(sha256.New, []byte(key))
+		binary.Write(mac, binary.BigEndian, counter)
+		mac.Write([]byte(input))
+		stream = mac.Sum(stream)
+	}
+	return stream[:n]
+}
+
+/* integer columns get another integer of their type, other columns the
+ * hex digest, cut to their maximum length */
+func maskHash(s string, col *Column) string {
+	if col.Type.Name == TypeInteger {
+		return maskInteger(s, col)
+	}
+
+	return maskFit(hex.EncodeToString(maskStream(col.MaskKey, s, sha256.Size)), col)
+}
+
+/* integers are permuted, so distinct keys stay distinct (and masked keys
+ * still join with the columns of the same type). The sign is kept, so
+ * unsigned columns stay positive. */
+func maskInteger(s string, col *Column) string {
+	if col.Type.Modifier == TypeHuge {
+		/* bigint unsigned */
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return s
+		}
+		return strconv.FormatUint(maskPermute(col.MaskKey, n, 64), 10)
+	}
+
+	bits := uint(64)
+	switch col.Type.Modifier {
+	case TypeSmall:
+		bits = 16
+	case TypeNormal:
+		bits = 32
+	}
+
+	/* integers of the source always parse */
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return s
+	}
+	if n >= 0 {
+		return strconv.FormatInt(int64(maskPermute(col.MaskKey, uint64(n), bits-1)), 10)
+	}
+	/* -1 .. -2^(bits-1) map onto 0 .. 2^(bits-1) - 1 */
+	return strconv.FormatInt(-1-int64(maskPermute(col.MaskKey, uint64(-1-n), bits-1)), 10)
+}
+
+/* a keyed permutation of 0 .. 2^bits - 1: a Feistel network over an even
+ * number of bits, applied again until the result is back in range (cycle
+ * walking) */
+func maskPermute(key string, v uint64, bits uint) uint64 {
+	half := (bits + 1) / 2
+	mask := uint64(1)<<half - 1
+	for {
+		l, r := v>>half, v&mask
+		for round := 0; round < 4; round++ {
+			f := binary.BigEndian.Uint64(maskStream(key, fmt.Sprintf("permute %v %v", round, r), 8))
+			l, r = r, (l^f)&mask
+		}
+		v = l<<half | r
+
+		if bits >= 64 || v < uint64(1)<<bits {
+			return v
+		}
+	}
+}
+
+/* replaces the local part by as many letters and digits and the domain by
+ * maskEmailDomain, the local part and then the domain are shortened if the
+ * address doesn't fit the column */
+func maskEmail(s string, col *Column) string {
+	local := s
+	if at := strings.LastIndex(s, "@"); at >= 0 {
+		local = s[:at]
+	}
+
+	n, domain := len(local), maskEmailDomain
+	if col.Type.HasMax() {
+		max := int(col.Type.Max)
+		if max < 2+len(domain) {
+			domain = maskEmailShortDomain
+		}
+		if n > max-1-len(domain) {
+			n = max - 1 - len(domain)
+		}
+		if n < 1 {
+			/* no address fits, only a cut one */
+			n = 1
+		}
+	}
+
+	const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+	stream := maskStream(col.MaskKey, s, n)
+	fake := make([]byte, n)
+	for i, b := range stream {
+		fake[i] = alphabet[int(b)%len(alphabet)]
+	}
+	if len(fake) > 0 && fake[0] >= '0' && fake[0] <= '9' {
+		/* some systems don't like a local part that starts with a digit */
+		fake[0] = alphabet[int(stream[0])%26]
+	}
+
+	return maskFit(string(fake)+"@"+domain, col)
+}
+
+/* replaces every digit, the formatting (+, spaces, dashes, ...) is kept */
+func maskPhone(s string, key string) string {
+	stream := maskStream(key, s, len(s))
+	fake := []byte(s)
+	for i, c := range fake {
+		if c >= '0' && c <= '9' {
+			fake[i] = '0' + stream[i]%10
+		}
+	}
+	return string(fake)
+}
+
+/* replaces every word, the first by a first name, the others by last
+ * names. If they don't fit the column, the last names are left out and the
+ * first name is cut. */
+func maskName(s string, col *Column) string {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		return s
+	}
+
+	stream := maskStream(col.MaskKey, s, len(words))
+	fake := make([]string, len(words))
+	for i, b := range stream {
+		if i == 0 {
+			fake[i] = maskFirstNames[int(b)%len(maskFirstNames)]
+		} else {
+			fake[i] = maskLastNames[int(b)%len(maskLastNames)]
+		}
+		if isUpper(words[i]) {
+			fake[i] = strings.ToUpper(fake[i])
+		}
+	}
+
+	name := strings.Join(fake, " ")
+	for n := len(fake) - 1; n > 0 && col.Type.HasMax() && uint(len(name)) > col.Type.Max; n-- {
+		name = strings.Join(fake[:n], " ")
+	}
+	return maskFit(name, col)
+}
+
+/* cuts a fake value (plain ASCII) to the maximum length of the column */
+func maskFit(s string, col *Column) string {
+	if col.Type.HasMax() && col.Type.Max < uint(len(s)) {
+		return s[:col.Type.Max]
+	}
+	return s
+}
+
+func isUpper(s string) bool {
+	for _, r := range s {
+		if unicode.IsLower(r) {
+			return false
+		}
+	}
+	return true
+}
+
+/* shifts the date part of a date, datetime or timestamp by a number of days
+ * that only depends on the key, so all dates move together and the order
+ * and distance between them is kept. Zero dates and anything that doesn't
+ * start with a valid date are left alone. */
+func maskShiftDate(s string, key string) string {
+	const layout = "2006-01-02"
+	if len(s) < len(layout) {
+		return s
+	}
+	date, err := time.Parse(layout, s[:len(layout)])
+	if err != nil {
+		return s
+	}
+
+	/* the lowest bit picks the direction */
+	n := binary.BigEndian.Uint16(maskStream(key, MaskShiftDate, 2))
+	days := 1 + int(n>>1)%maskMaxShiftDays
+	if n&1 == 1 {
+		days = -days
+	}
+
+	return date.AddDate(0, 0, days).Format(layout) + s[len(layout):]
+}
@@ -0,0 +1,110 @@
+package common
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+/* masked keys have to stay unique, or primary keys collide */
+func TestMaskHashIntegerIsInjective(t *testing.T) {
+	for _, modifier := range []TypeModifier{TypeSmall, TypeNormal, TypeLarge, TypeHuge} {
+		col := &Column{Mask: MaskHash, MaskKey: "secret", Type: IntType(modifier)}
+		seen := make(map[string]string)
+		for i := -500; i <= 1000; i++ {
+			if modifier == TypeHuge && i < 0 {
+				continue
+			}
+			val := strconv.Itoa(i)
+			masked, null := MaskValue(val, col)
+			if null {
+				t.Fatalf("MaskValue(%v) became NULL", val)
+			}
+			if other, ok := seen[masked]; ok {
+				t.Fatalf("modifier %v: %v and %v both mask to %v", modifier, other, val, masked)
+			}
+			seen[masked] = val
+
+			n, err := strconv.ParseInt(masked, 10, 64)
+			if modifier != TypeHuge && (err != nil || (n < 0) != (i < 0)) {
+				t.Errorf("modifier %v: %v masks to %v, the sign should be kept", modifier, val, masked)
+			}
+			if modifier == TypeSmall && (n > 32767 || n < -32768) {
+				t.Errorf("%v masks to %v, which isn't a smallint", val, masked)
+			}
+		}
+	}
+}
+
+/* the same key gives the same values in every run and column, so joins
+ * on masked keys line up */
+func TestMaskIsDeterministic(t *testing.T) {
+	for _, mask := range []string{MaskHash, MaskEmail, MaskPhone, MaskName} {
+		a := &Column{Mask: mask, MaskKey: "secret", Type: TextType()}
+		b := &Column{Mask: mask, MaskKey: "secret", Type: TextType()}
+		other := &Column{Mask: mask, MaskKey: "other", Type: TextType()}
+
+		val := "Jane Doe +1 555-0100 jane@corp.example"
+		ma, _ := MaskValue(val, a)
+		mb, _ := MaskValue(val, b)
+		mo, _ := MaskValue(val, other)
+		if ma != mb || ma == val || ma == mo {
+			t.Errorf("mask %v: %q, %q (other key %q)", mask, ma, mb, mo)
+		}
+	}
+}
+
+func TestMaskShiftDate(t *testing.T) {
+	col := &Column{Mask: MaskShiftDate, MaskKey: "secret", Type: TimestampType()}
+	first, _ := MaskValue("2021-03-01 10:00:00", col)
+	second, _ := MaskValue("2021-03-02 10:00:00.5", col)
+	if first[10:] != " 10:00:00" || second[10:] != " 10:00:00.5" {
+		t.Errorf("the time should be kept: %v, %v", first, second)
+	}
+	d1, _ := time.Parse("2006-01-02", first[:10])
+	d2, _ := time.Parse("2006-01-02", second[:10])
+	if d2.Sub(d1) != 24*time.Hour || first[:10] == "2021-03-01" {
+		t.Errorf("dates should move together: %v, %v", first, second)
+	}
+	if zero, _ := MaskValue("0000-00-00 00:00:00", col); zero != "0000-00-00 00:00:00" {
+		t.Errorf("zero dates should be left alone, got %v", zero)
+	}
+}
+
+/* fakes have to fit the column, or the insert fails */
+func TestMaskFitsColumn(t *testing.T) {
+	tests := []struct {
+		mask, val string
+		max       uint
+		want      string /* the domain or how many words are left */
+	}{
+		{MaskEmail, "someone.with.a.long.address@example.org", 20, "@example.com"},
+		{MaskEmail, "someone@example.org", 10, "@x.test"},
+		{MaskEmail, "someone@example.org", 4, ""},
+		{MaskName, "Jane Quincy Doe", 8, "1"},
+		{MaskName, "Jane Quincy Doe", 40, "3"},
+		{MaskName, "Jane Doe", 2, "1"},
+	}
+
+	for _, tt := range tests {
+		typ := TextType()
+		typ.Max = tt.max
+		col := &Column{Mask: tt.mask, MaskKey: "secret", Type: typ}
+		masked, _ := MaskValue(tt.val, col)
+		if uint(len(masked)) > tt.max {
+			t.Errorf("%v of %q = %q, longer than %v", tt.mask, tt.val, masked, tt.max)
+		}
+
+		switch tt.mask {
+		case MaskEmail:
+			if !strings.HasSuffix(masked, tt.want) {
+				t.Errorf("%v of %q = %q, want a %q domain", tt.mask, tt.val, masked, tt.want)
+			}
+		case MaskName:
+			if words := strconv.Itoa(len(strings.Fields(masked))); words != tt.want {
+				t.Errorf("%v of %q = %q, want %v word(s)", tt.mask, tt.val, masked, tt.want)
+			}
+		}
+	}
+}
@@ -21,6 +21,13 @@ type Reader interface {
 	FilteredTables(incl, excl map[string]bool) []*Table
 
 	Read(table *Table) (*sql.Rows, error)
+
+	/* like Read, but only returns the first limit rows */
+	Sample(table *Table, limit int) (*sql.Rows, error)
+
+	/* scans the values of the given columns of table */
+	Profile(table *Table, columns []*Column) ([]*Profile, error)
+
 	CreateView(name string, body string) error
 	DropView(name string) error
 
@@ -1,14 +1,113 @@
 package common
 
+import (
+	"database/sql"
+)
+
+const (
+	/* the ways an auto-increment column can be recreated in the destination */
+	AutoIncrIdentity = "identity"
+	AutoIncrSerial   = "serial"
+
+	/* the ways an enum column can be recreated in the destination */
+	EnumAsType  = "type"
+	EnumAsCheck = "check"
+
+	/* what to do with MySQL zero dates (0000-00-00, 2020-00-15, ...), any
+	 * other value is used verbatim as a replacement */
+	ZeroDateNull  = "null"
+	ZeroDateEpoch = "epoch"
+	ZeroDateFail  = "fail"
+
+	/* what to do with values of a json column that aren't valid JSON */
+	InvalidJsonFail = "fail"
+	InvalidJsonNull = "null"
+	InvalidJsonWrap = "wrap"
+
+	/* what binary (_bin) collated text becomes */
+	BinaryCollationC     = "c"
+	BinaryCollationBytea = "bytea"
+
+	/* what case-insensitive (_ci) collated text becomes, by default it
+	 * becomes regular (case-sensitive) text */
+	CaseInsensitiveCitext = "citext"
+	CaseInsensitiveIcu    = "icu"
+
+	/* what to do with NUL bytes and invalid UTF-8 in text */
+	SanitizeReplace = "replace"
+	SanitizeStrip   = "strip"
+	SanitizeFail    = "fail"
+
+	/* how the values of a column are masked, the keyed masks (hash, the
+	 * fakes and the date shift) give the same result for the same value
+	 * and key, whatever the table or run */
+	MaskNull      = "null"
+	MaskConstant  = "constant"
+	MaskHash      = "hash"
+	MaskEmail     = "email"
+	MaskPhone     = "phone"
+	MaskName      = "name"
+	MaskShiftDate = "shift_date"
+
+	/* the nondeterministic ICU collation created for CaseInsensitiveIcu */
+	CollationCaseInsensitive = "case_insensitive"
+)
+
 type Table struct {
 	Name    string
 	DbType  string /* mysql, postgres, sqlite, ... */
 	Columns []*Column
+
+	/* name in the destination if different, and the schema it goes into
+	 * if it's not the default */
+	DstName   string
+	DstSchema string
+
+	/* the next value the source would hand out for the auto-increment
+	 * column, 0 if unknown */
+	AutoIncrement uint64
+
+	/* name of the artificial primary key column to add in the destination
+	 * if the table doesn't have a primary key, empty means none is added */
+	SurrogateKey string
+
+	/* an SQL condition of the source that restricts which rows are read,
+	 * empty reads all of them */
+	Where string
+
+	/* secondary indexes that need to be recreated in the destination */
+	Indexes []*Index
+
+	/* columns that only exist in the destination, the data transfer
+	 * never mentions them so they're filled in by Default, which is only
+	 * set during the load */
+	Added []*AddedColumn
+}
+
+type AddedColumn struct {
+	Name    string
+	Type    string /* a type of the destination */
+	Default string /* an SQL expression of the destination */
+}
+
+/* what the values of a column actually look like */
+type Profile struct {
+	Column   *Column
+	Min      sql.NullString
+	Max      sql.NullString
+	Distinct int64
+}
+
+type Index struct {
+	Name    string
+	Columns []string
+	Spatial bool
 }
 
 type Column struct {
 	TableName    string
 	Name         string
+	DstName      string /* name in the destination, if different */
 	Type         *Type
 	RawType      string
 	Length       int
@@ -16,8 +115,105 @@ type Column struct {
 	PrimaryKey   bool
 	AutoIncr     bool
 	Default      interface{}
+	DefaultExpr  bool /* whether Default is an expression of the source */
 	NeedsQuoting bool
 
+	/* the type in the destination as declared in the config, empty if it
+	 * follows from Type */
+	DstType string
+
+	/* exact sizes, 0 if they don't apply to the type */
+	OctetLength int
+	Precision   int
+	Scale       int
+
+	Charset   string
+	Collation string
+
+	/* the collation to use in the destination, empty for the default,
+	 * and whether the column should become citext */
+	DstCollation string
+	Citext       bool
+
+	/* what to do with NUL bytes and invalid UTF-8, see the Sanitize*
+	 * consts, the default is SanitizeReplace */
+	Sanitize string
+
+	/* whether to repair text that was double-encoded (UTF-8 stored in a
+	 * latin1 column) */
+	RepairEncoding bool
+
+	/* the expression of a generated column, empty for regular columns */
+	Generated string
+	Comment   string
+
+	/* how to recreate the auto-increment, see the AutoIncr* consts, the
+	 * default is AutoIncrIdentity */
+	AutoIncrStyle string
+
+	/* how to recreate an enum column, see the EnumAs* consts, the
+	 * default is EnumAsType */
+	EnumStyle string
+
+	/* what to do with zero dates, see the ZeroDate* consts, the default
+	 * is ZeroDateNull */
+	ZeroDate string
+
+	/* what to do with invalid JSON documents, see the InvalidJson* consts,
+	 * the default is InvalidJsonFail */
+	InvalidJson string
+
+	/* whether to add a CHECK (col >= 0) for unsigned types */
+	CheckUnsigned bool
+
+	/* the time zone the values of a TypeTimeStampTz column are expressed
+	 * in, a name or an offset */
+	Zone string
+
 	/* how to select the column */
 	Select string
+
+	/* how the values are masked, see the Mask* consts, empty copies them
+	 * as they are. MaskValue is the replacement of MaskConstant, MaskKey
+	 * the secret of the keyed masks */
+	Mask      string
+	MaskValue string
+	MaskKey   string
+
+	/* the number of values that were changed during the transfer, by
+	 * reason, see CountChange */
+	Changes map[string]int
+}
+
+/* returns nil if the table has no column with that name */
+func (t *Table) Column(name string) *Column {
+	for _, col := range t.Columns {
+		if col.Name == name {
+			return col
+		}
+	}
+	return nil
+}
+
+/* the name of the table in the destination, without its schema */
+func (t *Table) Destination() string {
+	if t.DstName != "" {
+		return t.DstName
+	}
+	return t.Name
+}
+
+/* the name of the column in the destination */
+func (c *Column) Destination() string {
+	if c.DstName != "" {
+		return c.DstName
+	}
+	return c.Name
+}
+
+func (c *Column) CountChange(reason string) {
+	if c.Changes == nil {
+		c.Changes = make(map[string]int)
+	}
+	c.Changes[reason]++
 }
@@ -22,9 +22,21 @@ const (
 	TypeText      = "text"
 	TypeDate      = "date"
 	TypeTime      = "time"
+	TypeInterval  = "interval"
 	TypeTimeStamp = "timestamp"
 	TypeSet       = "set"
 	TypeJson      = "json"
+	TypeEnum      = "enum"
+
+	/* a timestamp that refers to an absolute point in time */
+	TypeTimeStampTz = "timestamptz"
+
+	/* spatial data, Subtype is the kind of geometry (point, polygon, ...) */
+	TypeGeometry = "geometry"
+
+	/* a type of the destination declared in the config, Subtype is its
+	 * name, values are passed on as text */
+	TypeDeclared = "declared"
 )
 
 type Type struct {
@@ -39,6 +51,20 @@ type Type struct {
 	Min       uint
 	Scale     uint
 	Precision uint
+
+	/* the allowed values of enumerated types */
+	Values []string
+
+	/* whether the source type only allows positive numbers */
+	Unsigned bool
+
+	/* whether the maximum should be kept even if it is large */
+	KeepMax bool
+
+	/* the kind of geometry and its spatial reference system, or the
+	 * declared type */
+	Subtype string
+	Srid    uint
 }
 
 func (t *Type) HasMax() bool {
@@ -60,7 +86,15 @@ func TextType() *Type                     { return simple(TypeText) }
 func DateType() *Type                     { return simple(TypeDate) }
 func TimeType() *Type                     { return simple(TypeTime) }
 func TimestampType() *Type                { return simple(TypeTimeStamp) }
-func SetType() *Type                      { return simple(TypeSet) }
+func TimestampTzType() *Type              { return simple(TypeTimeStampTz) }
+func JsonType() *Type                     { return simple(TypeJson) }
+func IntervalType() *Type                 { return simple(TypeInterval) }
+
+func SetType(values []string) *Type {
+	t := simple(TypeSet)
+	t.Values = values
+	return t
+}
 
 /* for external usage */
 func SimpleType(name string) *Type {
@@ -71,6 +105,24 @@ func NumericType(precision, scale uint) *Type {
 	return &Type{Name: TypeNumeric, Precision: precision, Scale: scale}
 }
 
+func EnumType(values []string) *Type {
+	t := simple(TypeEnum)
+	t.Values = values
+	return t
+}
+
+func DeclaredType(name string) *Type {
+	t := simple(TypeDeclared)
+	t.Subtype = name
+	return t
+}
+
+func GeometryType(subtype string) *Type {
+	t := simple(TypeGeometry)
+	t.Subtype = subtype
+	return t
+}
+
 func BitType(max uint) *Type {
 	t := simple(TypeBit)
 	t.Max = max
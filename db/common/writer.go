@@ -13,7 +13,7 @@ type Writer interface {
 
 	/* merge the contents of table */
 	MergeTable(src *Table, dstName, extraDstCond string, r Reader) error
-	ClearTable([]string)
+	ClearTable([]*Table)
 	GetDB() *sql.DB
 
 	/* (over)write the contents of table */
@@ -3,6 +3,8 @@ package mysql
 import (
 	"database/sql"
 	"fmt"
+	"net/url"
+	"strings"
 
 	"github.com/barnettzqg/gomig/db/common"
 )
@@ -19,9 +21,25 @@ func openDB(conf *common.Config) (*sql.DB, error) {
 		address = fmt.Sprintf("%v:%v", conf.Hostname, port)
 	}
 
+	/* dates are kept as strings (no parseTime) so zero dates survive, the
+	 * session time zone decides how TIMESTAMP values are presented, the
+	 * server's zone is used if none is configured */
+	params := url.Values{}
+	params.Set("parseTime", "false")
+	if zone := conf.Timezone; zone != "" {
+		loc := zone
+		if strings.HasPrefix(zone, "+") || strings.HasPrefix(zone, "-") {
+			/* loc only understands names */
+			loc = "UTC"
+		}
+		params.Set("loc", loc)
+		params.Set("time_zone", "'"+zone+"'")
+	}
+	params.Set("charset", SessionCharset(conf))
+
 	/* root:pw@unix(/tmp/mysql.sock)/myDatabase?loc=Local */
-	uri := fmt.Sprintf("%v:%v@%v(%v)/%v", conf.Username, conf.Password,
-		protocol, address, conf.Database)
+	uri := fmt.Sprintf("%v:%v@%v(%v)/%v?%v", conf.Username, conf.Password,
+		protocol, address, conf.Database, params.Encode())
 	db, err := sql.Open("mysql", uri)
 	if err != nil {
 		return nil, err
@@ -35,3 +53,12 @@ func openDB(conf *common.Config) (*sql.DB, error) {
 
 	return db, nil
 }
+
+/* the connection character set, utf8mb4 unless configured otherwise as
+ * utf8 (utf8mb3) can't represent e.g. emoji */
+func SessionCharset(conf *common.Config) string {
+	if conf.Charset == "" {
+		return "utf8mb4"
+	}
+	return conf.Charset
+}
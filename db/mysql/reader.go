@@ -9,19 +9,28 @@ import (
 	"github.com/barnettzqg/gomig/db/common"
 )
 
+func quote(name string) string {
+	return common.QuoteIdentifier("mysql", name)
+}
+
 var (
 	READER_VERBOSE = false
 )
 
 var (
-	mysqlInit = []string{
-		"SET collation_connection = utf8_general_ci",
-		"SET NAMES utf8",
-	}
+	/* the character set and time zone are passed in the DSN instead, so
+	 * that every connection in the pool gets them */
+	mysqlInit = []string{}
 )
 
 type MysqlReader struct {
 	*sql.DB
+
+	/* the session time zone, empty if it is the server's */
+	zone string
+
+	/* the connection character set */
+	charset string
 }
 
 func OpenReader(conf *common.Config) (*MysqlReader, error) {
@@ -39,7 +48,7 @@ func OpenReader(conf *common.Config) (*MysqlReader, error) {
 		}
 	}
 
-	return &MysqlReader{db}, nil
+	return &MysqlReader{db, conf.Timezone, SessionCharset(conf)}, nil
 }
 
 func (r *MysqlReader) TableNames() []string {
@@ -89,8 +98,19 @@ func (r *MysqlReader) FilteredTables(incl, excl map[string]bool) []*common.Table
 			log.Println("mysql: could not fetch columns of table", tableName, "error:", err)
 		}
 
+		/* the auto-increment counter can be ahead of the highest id (deleted
+		 * rows), so remember it for the destination sequence */
+		autoIncr, err := r.autoIncrement(tableName)
+		if err != nil {
+			log.Println("mysql: could not fetch auto-increment counter of table", tableName, "error:", err)
+		}
+
 		/* create table struct */
-		table := &common.Table{Name: tableName, DbType: "mysql", Columns: columns}
+		table := &common.Table{Name: tableName, DbType: "mysql", Columns: columns, AutoIncrement: autoIncr}
+
+		if err := r.spatial(table); err != nil {
+			log.Println("mysql: could not fetch spatial information of table", tableName, "error:", err)
+		}
 
 		tables = append(tables, table)
 	}
@@ -99,16 +119,32 @@ func (r *MysqlReader) FilteredTables(incl, excl map[string]bool) []*common.Table
 }
 
 type rawCol struct {
-	name    string
-	rawtype string
-	null    string
-	key     string
-	defval  sql.NullString
-	extra   string
+	name       string
+	rawtype    string
+	null       string
+	key        string
+	defval     sql.NullString
+	extra      string
+	charlen    sql.NullInt64
+	octetlen   sql.NullInt64
+	precision  sql.NullInt64
+	scale      sql.NullInt64
+	charset    sql.NullString
+	collation  sql.NullString
+	generation sql.NullString
+	comment    string
 }
 
+const columnsQuery = `
+SELECT COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE, COLUMN_KEY, COLUMN_DEFAULT, EXTRA,
+       CHARACTER_MAXIMUM_LENGTH, CHARACTER_OCTET_LENGTH, NUMERIC_PRECISION, NUMERIC_SCALE,
+       CHARACTER_SET_NAME, COLLATION_NAME, GENERATION_EXPRESSION, COLUMN_COMMENT
+FROM   information_schema.COLUMNS
+WHERE  TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?
+ORDER BY ORDINAL_POSITION;`
+
 func (r *MysqlReader) columns(table string) ([]*common.Column, error) {
-	rows, err := r.Query(fmt.Sprintf("EXPLAIN `%v`;", table))
+	rows, err := r.Query(columnsQuery, table)
 	if err != nil {
 		return nil, err
 	}
@@ -118,7 +154,9 @@ func (r *MysqlReader) columns(table string) ([]*common.Column, error) {
 
 	var rc rawCol
 	for rows.Next() {
-		err = rows.Scan(&rc.name, &rc.rawtype, &rc.null, &rc.key, &rc.defval, &rc.extra)
+		err = rows.Scan(&rc.name, &rc.rawtype, &rc.null, &rc.key, &rc.defval, &rc.extra,
+			&rc.charlen, &rc.octetlen, &rc.precision, &rc.scale,
+			&rc.charset, &rc.collation, &rc.generation, &rc.comment)
 		if err != nil {
 			return nil, err
 		}
@@ -138,27 +176,152 @@ func (r *MysqlReader) columns(table string) ([]*common.Column, error) {
 	return cols, nil
 }
 
+/* returns 0 if the table has no auto-increment counter */
+func (r *MysqlReader) autoIncrement(table string) (uint64, error) {
+	var counter sql.NullInt64
+	err := r.QueryRow("SELECT AUTO_INCREMENT FROM information_schema.TABLES "+
+		"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?;", table).Scan(&counter)
+	if err != nil {
+		return 0, err
+	}
+	if !counter.Valid || counter.Int64 < 0 {
+		return 0, nil
+	}
+
+	return uint64(counter.Int64), nil
+}
+
+/* fills in the SRID and the way to select geometry columns, and the
+ * spatial indexes of the table */
+func (r *MysqlReader) spatial(table *common.Table) error {
+	geoCols := make(map[string]*common.Column)
+	for _, col := range table.Columns {
+		if col.Type.Name == common.TypeGeometry {
+			geoCols[col.Name] = col
+		}
+	}
+	if len(geoCols) == 0 {
+		return nil
+	}
+
+	/* SRS_ID only exists since MySQL 8, before that the SRID wasn't part
+	 * of the column definition */
+	mysql8 := false
+	rows, err := r.Query("SELECT COLUMN_NAME, SRS_ID FROM information_schema.COLUMNS "+
+		"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND SRS_ID IS NOT NULL;", table.Name)
+	if err == nil {
+		defer rows.Close()
+		mysql8 = true
+
+		var (
+			name string
+			srid uint
+		)
+		for rows.Next() {
+			if err := rows.Scan(&name, &srid); err != nil {
+				return err
+			}
+			if col, ok := geoCols[name]; ok && srid != 0 {
+				col.Type.Srid = srid
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	} else if READER_VERBOSE {
+		log.Println("mysql: no SRS_ID information for table", table.Name, err)
+	}
+
+	/* the internal format is not WKB, it's prefixed with the SRID in
+	 * little-endian. Values are read as WKB prefixed with their SRID in
+	 * big-endian, so they keep it when the column doesn't declare one. */
+	for _, col := range geoCols {
+		name := quote(col.Name)
+		wkb := fmt.Sprintf("ST_AsBinary(%v)", name)
+		if mysql8 {
+			/* geographic SRSs have latitude first in MySQL 8, postgis
+			 * expects longitude first */
+			wkb = fmt.Sprintf("ST_AsBinary(%v, 'axis-order=long-lat')", name)
+		}
+		col.Select = fmt.Sprintf("CONCAT(UNHEX(LPAD(HEX(ST_SRID(%v)), 8, '0')), %v)", name, wkb)
+	}
+
+	indexes, err := r.spatialIndexes(table.Name)
+	if err != nil {
+		return err
+	}
+	table.Indexes = append(table.Indexes, indexes...)
+
+	return nil
+}
+
+func (r *MysqlReader) spatialIndexes(table string) ([]*common.Index, error) {
+	rows, err := r.Query("SELECT INDEX_NAME, COLUMN_NAME FROM information_schema.STATISTICS "+
+		"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_TYPE = 'SPATIAL' "+
+		"ORDER BY INDEX_NAME, SEQ_IN_INDEX;", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	indexes := make([]*common.Index, 0, 2)
+
+	var name, column string
+	for rows.Next() {
+		if err := rows.Scan(&name, &column); err != nil {
+			return nil, err
+		}
+
+		if len(indexes) == 0 || indexes[len(indexes)-1].Name != name {
+			indexes = append(indexes, &common.Index{Name: name, Spatial: true})
+		}
+		idx := indexes[len(indexes)-1]
+		idx.Columns = append(idx.Columns, column)
+	}
+
+	return indexes, rows.Err()
+}
+
 func (r *MysqlReader) processCol(table string, rc *rawCol) (*common.Column, error) {
 	t := rc.rawtype
-	length := 255
+
+	/* TIMESTAMP values are presented in the session time zone */
+	var zone string
+	if strings.HasPrefix(t, "timestamp") {
+		zone = r.zone
+	}
+
+	/* MySQL 8 marks expression defaults, CURRENT_TIMESTAMP is marked as
+	 * well but is understood as it is */
+	defexpr := rc.defval.Valid && strings.Contains(rc.extra, "DEFAULT_GENERATED") &&
+		!strings.HasPrefix(strings.ToUpper(rc.defval.String), "CURRENT_TIMESTAMP")
 
 	return &common.Column{
 		TableName:    table,
 		Name:         rc.name,
 		Type:         MysqlToGenericType(t),
 		RawType:      t,
-		Length:       length,
-		Null:         rc.null == "YES" || strings.HasPrefix(t, "enum") || t == "date" || t == "datetime" || t == "timestamp",
+		Length:       int(rc.charlen.Int64),
+		OctetLength:  int(rc.octetlen.Int64),
+		Precision:    int(rc.precision.Int64),
+		Scale:        int(rc.scale.Int64),
+		Null:         rc.null == "YES",
 		PrimaryKey:   rc.key == "PRI",
-		AutoIncr:     rc.extra == "auto_increment",
+		AutoIncr:     strings.Contains(rc.extra, "auto_increment"),
 		Default:      rc.defval,
+		DefaultExpr:  defexpr,
 		NeedsQuoting: strings.Contains(t, "text") || strings.Contains(t, "varchar"),
+		Charset:      rc.charset.String,
+		Collation:    rc.collation.String,
+		Generated:    rc.generation.String,
+		Comment:      rc.comment,
+		Zone:         zone,
 	}, nil
 }
 
 /* caller is responsible for cleaning up the sql.Rows object */
 func (r *MysqlReader) Read(table *common.Table) (*sql.Rows, error) {
-	rows, err := r.Query(fmt.Sprintf("SELECT * FROM %v;", table.Name))
+	rows, err := r.Query(fmt.Sprintf("SELECT %v FROM %v%v;", selectList(table), quote(table.Name), where(table)))
 	if err != nil {
 		return nil, err
 	}
@@ -176,15 +339,88 @@ func (r *MysqlReader) Read(table *common.Table) (*sql.Rows, error) {
 	return rows, nil
 }
 
+/* caller is responsible for cleaning up the sql.Rows object */
+func (r *MysqlReader) Sample(table *common.Table, limit int) (*sql.Rows, error) {
+	return r.Query(fmt.Sprintf("SELECT %v FROM %v%v LIMIT %v;",
+		selectList(table), quote(table.Name), where(table), limit))
+}
+
+func (r *MysqlReader) Profile(table *common.Table, columns []*common.Column) ([]*common.Profile, error) {
+	if len(columns) == 0 {
+		return nil, nil
+	}
+
+	exprs := make([]string, 0, 3*len(columns))
+	for _, col := range columns {
+		name := selectExpr(col)
+		exprs = append(exprs,
+			fmt.Sprintf("MIN(%v)", name),
+			fmt.Sprintf("MAX(%v)", name),
+			fmt.Sprintf("COUNT(DISTINCT %v)", name))
+	}
+
+	profiles := make([]*common.Profile, 0, len(columns))
+	dest := make([]interface{}, 0, len(exprs))
+	for _, col := range columns {
+		p := &common.Profile{Column: col}
+		profiles = append(profiles, p)
+		dest = append(dest, &p.Min, &p.Max, &p.Distinct)
+	}
+
+	stmt := fmt.Sprintf("SELECT %v FROM %v%v;", strings.Join(exprs, ", "), quote(table.Name), where(table))
+	if READER_VERBOSE {
+		log.Printf("mysql: profiling:\n%v\n", stmt)
+	}
+	if err := r.QueryRow(stmt).Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+/* the WHERE clause that filters the rows of table, if any */
+func where(table *common.Table) string {
+	if table.Where == "" {
+		return ""
+	}
+	return fmt.Sprintf(" WHERE (%v)", table.Where)
+}
+
+/* the columns to select, using Column.Select where it's specified */
+func selectList(table *common.Table) string {
+	if len(table.Columns) == 0 {
+		return "*"
+	}
+
+	cols := make([]string, 0, len(table.Columns))
+	for _, col := range table.Columns {
+		if col.Select != "" {
+			cols = append(cols, fmt.Sprintf("%v AS %v", col.Select, quote(col.Name)))
+		} else {
+			cols = append(cols, quote(col.Name))
+		}
+	}
+
+	return strings.Join(cols, ", ")
+}
+
+/* the expression a column is read with */
+func selectExpr(col *common.Column) string {
+	if col.Select != "" {
+		return "(" + col.Select + ")"
+	}
+	return quote(col.Name)
+}
+
 func (r *MysqlReader) CreateView(name string, body string) error {
-	stmt := fmt.Sprintf("CREATE VIEW %v AS %v;", name, body)
+	stmt := fmt.Sprintf("CREATE VIEW %v AS %v;", quote(name), body)
 
 	_, err := r.Exec(stmt)
 	return err
 }
 
 func (r *MysqlReader) DropView(name string) error {
-	stmt := fmt.Sprintf("DROP VIEW %v;", name)
+	stmt := fmt.Sprintf("DROP VIEW %v;", quote(name))
 
 	_, err := r.Exec(stmt)
 	return err
@@ -194,7 +430,11 @@ func (r *MysqlReader) DropView(name string) error {
 func (r *MysqlReader) CreateProjection(name string, body string, engine string, pk []string, uks [][]string) error {
 	var createPk string
 	if len(pk) > 0 {
-		createPk = " ( " + "PRIMARY KEY (" + strings.Join(pk, ", ") + ")" + " )"
+		quoted := make([]string, 0, len(pk))
+		for _, col := range pk {
+			quoted = append(quoted, quote(col))
+		}
+		createPk = " ( " + "PRIMARY KEY (" + strings.Join(quoted, ", ") + ")" + " )"
 	} else {
 		createPk = ""
 	}
@@ -204,10 +444,10 @@ func (r *MysqlReader) CreateProjection(name string, body string, engine string,
 		engineSQL = " ENGINE=" + strings.ToUpper(engine)
 	}
 
-	collation := " CHARACTER SET utf8 COLLATE utf8_general_ci"
+	collation := " CHARACTER SET " + r.charset
 
 	stmt := fmt.Sprintf("CREATE TABLE %v%v%v%v AS (\n%v\n);",
-		name, createPk, engineSQL, collation, body)
+		quote(name), createPk, engineSQL, collation, body)
 
 	if READER_VERBOSE {
 		log.Printf("mysql: creating projection:\n%v\n", stmt)
@@ -217,7 +457,7 @@ func (r *MysqlReader) CreateProjection(name string, body string, engine string,
 }
 
 func (r *MysqlReader) DropProjection(name string) error {
-	stmt := fmt.Sprintf("DROP TABLE %v;", name)
+	stmt := fmt.Sprintf("DROP TABLE %v;", quote(name))
 
 	_, err := r.Exec(stmt)
 	return err
@@ -12,31 +12,41 @@ import (
 func MysqlToGenericType(mysqlType string) *common.Type {
 	rt := mysqlType
 	switch {
-	case rt == "set":
-		return common.SetType()
+	/* enum and set have to come first, their values might contain e.g. "int" */
+	case strings.HasPrefix(rt, "enum("):
+		return common.EnumType(ExtractValues(rt))
+	case strings.HasPrefix(rt, "set("), rt == "set":
+		return common.SetType(ExtractValues(rt))
+	case isGeometryType(rt):
+		return common.GeometryType(rt)
+	case rt == "json":
+		return common.JsonType()
 	case rt == "date":
 		return common.DateType()
-	case rt == "time":
+	case rt == "time", strings.HasPrefix(rt, "time("):
 		return common.TimeType()
-	case rt == "datetime", rt == "timestamp":
+	case strings.HasPrefix(rt, "datetime"):
 		return common.TimestampType()
-	case strings.Contains(rt, "float"):
+	case strings.HasPrefix(rt, "timestamp"):
+		return common.TimestampTzType()
+	case rt == "year", strings.HasPrefix(rt, "year("):
+		return common.IntType(common.TypeSmall)
+	case strings.HasPrefix(rt, "float"):
+		/* float(p) is a double if p > 24, float(m, d) is always a float */
+		if ExtractLength(rt) > 24 {
+			return common.DoubleType()
+		}
 		return common.FloatType()
-	case strings.Contains(rt, "double"):
+	case strings.HasPrefix(rt, "double"), strings.HasPrefix(rt, "real"):
+		/* real is a synonym for double, unless REAL_AS_FLOAT is set */
 		return common.DoubleType()
-	case strings.Contains(rt, "numeric"), strings.Contains(rt, "decimal"):
-		scale, precision := ExtractPrecisionAndScale(rt)
-		return common.NumericType(scale, precision)
-	case strings.Contains(rt, "tinyint"):
-		return common.BoolType()
-	case rt == "smallint", rt == "year":
-		return common.IntType(common.TypeSmall)
-	case rt == "bigint", rt == "int unsigned":
-		return common.IntType(common.TypeLarge)
-	case rt == "bigint unsigned":
-		return common.IntType(common.TypeHuge)
-	case strings.Contains(rt, "int"), rt == "smallint unsigned":
-		return common.IntType(common.TypeNormal)
+	case strings.HasPrefix(rt, "decimal"), strings.HasPrefix(rt, "numeric"),
+		strings.HasPrefix(rt, "dec"), strings.HasPrefix(rt, "fixed"):
+		precision, scale := ExtractPrecisionAndScale(rt)
+		return common.NumericType(precision, scale)
+	case isIntegerType(rt):
+		it, _ := ParseIntegerType(rt)
+		return integerToGenericType(it)
 	case strings.Contains(rt, "blob"), strings.Contains(rt, "binary"):
 		return common.BlobType()
 	case strings.HasPrefix(rt, "char"):
@@ -49,7 +59,7 @@ func MysqlToGenericType(mysqlType string) *common.Type {
 		return t
 	case strings.HasPrefix(rt, "bit") && rt != "bit":
 		return common.BitType(ExtractLength(rt))
-	case rt == "bit", rt == "bit(1)", rt == "tinyint(1)", rt == "tinyint(1) unsigned":
+	case rt == "bit", rt == "bit(1)":
 		return common.BoolType()
 	default:
 		log.Println("WARNING: mysql: encountered an unknown type, ", rt)
@@ -57,6 +67,103 @@ func MysqlToGenericType(mysqlType string) *common.Type {
 	}
 }
 
+func isGeometryType(mysqlType string) bool {
+	switch mysqlType {
+	case "geometry", "point", "linestring", "polygon", "multipoint",
+		"multilinestring", "multipolygon", "geometrycollection", "geomcollection":
+		return true
+	}
+	return false
+}
+
+/* the parts of a MySQL integer type such as int(11) unsigned zerofill */
+type IntegerType struct {
+	Name     string /* tinyint, smallint, mediumint, int or bigint */
+	Width    uint   /* display width, 0 if not given */
+	Unsigned bool
+	Zerofill bool
+}
+
+var integerTypeRegexp = regexp.MustCompile(
+	`^(tinyint|smallint|mediumint|int|integer|bigint)(?:\((\d+)\))?((?:\s+(?:signed|unsigned|zerofill))*)$`)
+
+func isIntegerType(mysqlType string) bool {
+	_, ok := ParseIntegerType(mysqlType)
+	return ok
+}
+
+/* parses a MySQL integer type, returns false if it isn't one */
+func ParseIntegerType(mysqlType string) (*IntegerType, bool) {
+	/* matches should be: [mysqlType, name, width, attributes] */
+	matches := integerTypeRegexp.FindStringSubmatch(strings.ToLower(strings.TrimSpace(mysqlType)))
+	if len(matches) != 4 {
+		return nil, false
+	}
+
+	it := &IntegerType{Name: matches[1]}
+	if it.Name == "integer" {
+		it.Name = "int"
+	}
+	if matches[2] != "" {
+		width, err := strconv.Atoi(matches[2])
+		if err != nil {
+			return nil, false
+		}
+		it.Width = uint(width)
+	}
+	for _, attr := range strings.Fields(matches[3]) {
+		switch attr {
+		case "unsigned":
+			it.Unsigned = true
+		case "zerofill":
+			/* zerofill implies unsigned */
+			it.Zerofill = true
+			it.Unsigned = true
+		}
+	}
+
+	return it, true
+}
+
+/* picks an integer type that can hold the full range of the MySQL type,
+ * the unsigned types need the next larger type */
+func integerToGenericType(it *IntegerType) *common.Type {
+	var t *common.Type
+	switch it.Name {
+	case "tinyint":
+		/* tinyint(1) is the conventional boolean, MySQL >= 8.0.19 only
+		 * shows the width for it, a tinyint(1) unsigned holds up to 255 */
+		if it.Width == 1 && !it.Unsigned {
+			return common.BoolType()
+		}
+		t = common.IntType(common.TypeSmall)
+	case "smallint":
+		if it.Unsigned {
+			t = common.IntType(common.TypeNormal)
+		} else {
+			t = common.IntType(common.TypeSmall)
+		}
+	case "mediumint":
+		/* even unsigned (0 - 16777215) fits in an integer */
+		t = common.IntType(common.TypeNormal)
+	case "int":
+		if it.Unsigned {
+			t = common.IntType(common.TypeLarge)
+		} else {
+			t = common.IntType(common.TypeNormal)
+		}
+	default:
+		if it.Unsigned {
+			t = common.IntType(common.TypeHuge)
+		} else {
+			t = common.IntType(common.TypeLarge)
+		}
+	}
+
+	t.Unsigned = it.Unsigned
+	return t
+}
+
 /* returns 0 if no length could be determined */
 func ExtractLength(mysqlType string) uint {
 	/* matches should be: [mysqlType, length] */
@@ -74,21 +181,62 @@ func ExtractLength(mysqlType string) uint {
 	return uint(i)
 }
 
-/* returns a precision, scale tuple */
+/* returns a precision, scale tuple, decimal(p) has scale 0 and a plain
+ * decimal is decimal(10, 0), as in MySQL */
 func ExtractPrecisionAndScale(mysqlType string) (uint, uint) {
-	/* we should get something like: TYPE(precision, scale) */
+	/* we should get something like: TYPE(precision, scale) or TYPE(precision) */
 	/* matches should be: [mysqlType, precision, scale] */
-	matches := regexp.MustCompile(`\w+\(\s*(\d+)\s*,\s*(\d+)\s*\)`).FindStringSubmatch(mysqlType)
+	matches := regexp.MustCompile(`\w+\(\s*(\d+)\s*(?:,\s*(\d+)\s*)?\)`).FindStringSubmatch(mysqlType)
 
 	if len(matches) != 3 {
-		return 0, 0
+		return 10, 0
 	}
 
 	precision, err := strconv.Atoi(matches[1])
 	if err != nil {
 		return 0, 0
 	}
+	if matches[2] == "" {
+		return uint(precision), 0
+	}
+
 	scale, err := strconv.Atoi(matches[2])
+	if err != nil {
+		return uint(precision), 0
+	}
 
 	return uint(precision), uint(scale)
 }
+
+/* returns the members of an enum('a','b') or set('a','b') type */
+func ExtractValues(mysqlType string) []string {
+	start := strings.Index(mysqlType, "(")
+	end := strings.LastIndex(mysqlType, ")")
+	if start < 0 || end < start {
+		return nil
+	}
+
+	list := mysqlType[start+1 : end]
+	values := make([]string, 0, 8)
+	cur := make([]byte, 0, 16)
+	inQuote := false
+	for i := 0; i < len(list); i++ {
+		c := list[i]
+		switch {
+		case !inQuote:
+			inQuote = c == '\''
+		case c == '\'' && i+1 < len(list) && list[i+1] == '\'':
+			/* quotes inside values are doubled */
+			cur = append(cur, c)
+			i++
+		case c == '\'':
+			inQuote = false
+			values = append(values, string(cur))
+			cur = cur[:0]
+		default:
+			cur = append(cur, c)
+		}
+	}
+
+	return values
+}
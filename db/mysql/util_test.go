@@ -0,0 +1,140 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/barnettzqg/gomig/db/common"
+)
+
+func unsigned(t *common.Type) *common.Type {
+	t.Unsigned = true
+	return t
+}
+
+func withMax(t *common.Type, max uint) *common.Type {
+	t.Max = max
+	return t
+}
+
+/* the type strings as information_schema.COLUMNS.COLUMN_TYPE shows them,
+ * MySQL >= 8.0.19 leaves out the display width of integers except for
+ * tinyint(1) */
+func TestMysqlToGenericType(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want *common.Type
+	}{
+		{"tinyint(1)", common.BoolType()},
+		{"tinyint", common.IntType(common.TypeSmall)},
+		{"tinyint(4)", common.IntType(common.TypeSmall)},
+		{"tinyint(1) unsigned", unsigned(common.IntType(common.TypeSmall))},
+		{"tinyint unsigned", unsigned(common.IntType(common.TypeSmall))},
+		{"tinyint(3) unsigned zerofill", unsigned(common.IntType(common.TypeSmall))},
+		{"smallint", common.IntType(common.TypeSmall)},
+		{"smallint(6)", common.IntType(common.TypeSmall)},
+		{"smallint unsigned", unsigned(common.IntType(common.TypeNormal))},
+		{"mediumint", common.IntType(common.TypeNormal)},
+		{"mediumint(8) unsigned", unsigned(common.IntType(common.TypeNormal))},
+		{"int", common.IntType(common.TypeNormal)},
+		{"int(11)", common.IntType(common.TypeNormal)},
+		{"int unsigned", unsigned(common.IntType(common.TypeLarge))},
+		{"int(10) unsigned zerofill", unsigned(common.IntType(common.TypeLarge))},
+		{"bigint", common.IntType(common.TypeLarge)},
+		{"bigint(20)", common.IntType(common.TypeLarge)},
+		{"bigint unsigned", unsigned(common.IntType(common.TypeHuge))},
+		{"bigint(20) unsigned", unsigned(common.IntType(common.TypeHuge))},
+		{"decimal", common.NumericType(10, 0)},
+		{"decimal(10)", common.NumericType(10, 0)},
+		{"decimal(10,2)", common.NumericType(10, 2)},
+		{"decimal(65,30) unsigned", common.NumericType(65, 30)},
+		{"numeric(5,1)", common.NumericType(5, 1)},
+		{"float", common.FloatType()},
+		{"float(10)", common.FloatType()},
+		{"float(30)", common.DoubleType()},
+		{"float(7,3)", common.FloatType()},
+		{"float unsigned", common.FloatType()},
+		{"double", common.DoubleType()},
+		{"double(8,2)", common.DoubleType()},
+		{"double unsigned", common.DoubleType()},
+		{"real", common.DoubleType()},
+		{"date", common.DateType()},
+		{"time", common.TimeType()},
+		{"time(3)", common.TimeType()},
+		{"datetime", common.TimestampType()},
+		{"datetime(6)", common.TimestampType()},
+		{"timestamp", common.TimestampTzType()},
+		{"timestamp(3)", common.TimestampTzType()},
+		{"year", common.IntType(common.TypeSmall)},
+		{"year(4)", common.IntType(common.TypeSmall)},
+		{"bit(1)", common.BitType(1)},
+		{"bit(8)", common.BitType(8)},
+		{"char(36)", withMax(common.PaddedTextType(), 36)},
+		{"varchar(255)", withMax(common.TextType(), 255)},
+		{"text", common.TextType()},
+		{"longtext", common.TextType()},
+		{"blob", common.BlobType()},
+		{"varbinary(16)", common.BlobType()},
+		{"json", common.JsonType()},
+		{"enum('a','int','it''s')", common.EnumType([]string{"a", "int", "it's"})},
+		{"set('x','y')", common.SetType([]string{"x", "y"})},
+		{"point", common.GeometryType("point")},
+	}
+
+	for _, tt := range tests {
+		if got := MysqlToGenericType(tt.raw); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("MysqlToGenericType(%q) = %+v, want %+v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestParseIntegerType(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want *IntegerType
+	}{
+		{"tinyint", &IntegerType{Name: "tinyint"}},
+		{"tinyint(1)", &IntegerType{Name: "tinyint", Width: 1}},
+		{"TINYINT(1) UNSIGNED", &IntegerType{Name: "tinyint", Width: 1, Unsigned: true}},
+		{"integer", &IntegerType{Name: "int"}},
+		{"int(10) unsigned zerofill", &IntegerType{Name: "int", Width: 10, Unsigned: true, Zerofill: true}},
+		{"int zerofill", &IntegerType{Name: "int", Unsigned: true, Zerofill: true}},
+		{"bigint signed", &IntegerType{Name: "bigint"}},
+		{"mediumint(8) unsigned", &IntegerType{Name: "mediumint", Width: 8, Unsigned: true}},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseIntegerType(tt.raw)
+		if !ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseIntegerType(%q) = %+v, %v, want %+v", tt.raw, got, ok, tt.want)
+		}
+	}
+
+	for _, raw := range []string{"point", "interval", "int(", "double", "intx"} {
+		if _, ok := ParseIntegerType(raw); ok {
+			t.Errorf("ParseIntegerType(%q) should fail", raw)
+		}
+	}
+}
+
+func TestExtractPrecisionAndScale(t *testing.T) {
+	tests := []struct {
+		raw              string
+		precision, scale uint
+	}{
+		{"decimal", 10, 0},
+		{"decimal(10)", 10, 0},
+		{"decimal(10,2)", 10, 2},
+		{"decimal( 12 , 4 )", 12, 4},
+		{"decimal(65,30) unsigned zerofill", 65, 30},
+		{"numeric(5)", 5, 0},
+	}
+
+	for _, tt := range tests {
+		precision, scale := ExtractPrecisionAndScale(tt.raw)
+		if precision != tt.precision || scale != tt.scale {
+			t.Errorf("ExtractPrecisionAndScale(%q) = %v, %v, want %v, %v",
+				tt.raw, precision, scale, tt.precision, tt.scale)
+		}
+	}
+}
@@ -39,7 +39,7 @@ func NewPgDbExecutor(db *sql.DB) (*PgDbExecutor, error) {
 	return &PgDbExecutor{*base, nil}, nil
 }
 
-func (e *PgDbExecutor) BulkInit(table string, columns ...string) error {
+func (e *PgDbExecutor) BulkInit(schema, table string, columns ...string) error {
 	db := e.GetDb()
 	if db == nil {
 		return errors.New("executor did not have a valid database")
@@ -51,6 +51,9 @@ func (e *PgDbExecutor) BulkInit(table string, columns ...string) error {
 	)
 	tx := e.GetTx()
 	copySql := pq.CopyIn(table, columns...)
+	if schema != "" {
+		copySql = pq.CopyInSchema(schema, table, columns...)
+	}
 	if tx == nil {
 		stmt, err = db.Prepare(copySql)
 	} else {
@@ -1,16 +1,83 @@
 package postgres
 
 import (
+	"bytes"
 	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"log"
+	"strconv"
 	"strings"
-	"time"
+	"unicode/utf8"
 
 	"github.com/barnettzqg/gomig/db/common"
 )
 
-func PostgresToGenericType(postgresType string) string {
-	return postgresType
+/* the generic type whose values convert to postgresType, nil if there is
+ * none. Parameters that only matter to the type itself, like a maximum
+ * length, are kept so GenericToPostgresType gives the same type back. */
+func PostgresToGenericType(postgresType string) *common.Type {
+	pt := strings.ToLower(strings.TrimSpace(postgresType))
+	name, args := pt, ""
+	if i := strings.Index(pt, "("); i >= 0 && strings.HasSuffix(pt, ")") {
+		name, args = strings.TrimSpace(pt[:i]), pt[i+1:len(pt)-1]
+	}
+	length := func() uint {
+		n, _ := strconv.Atoi(strings.TrimSpace(args))
+		return uint(n)
+	}
+
+	switch name {
+	case "boolean", "bool":
+		return common.BoolType()
+	case "smallint", "int2":
+		return common.IntType(common.TypeSmall)
+	case "integer", "int", "int4":
+		return common.IntType(common.TypeNormal)
+	case "bigint", "int8":
+		return common.IntType(common.TypeLarge)
+	case "numeric", "decimal":
+		var precision, scale int
+		parts := strings.Split(args, ",")
+		precision, _ = strconv.Atoi(strings.TrimSpace(parts[0]))
+		if len(parts) > 1 {
+			scale, _ = strconv.Atoi(strings.TrimSpace(parts[1]))
+		}
+		return common.NumericType(uint(precision), uint(scale))
+	case "real", "float4":
+		return common.FloatType()
+	case "double precision", "float8":
+		return common.DoubleType()
+	case "text":
+		return common.TextType()
+	case "character varying", "varchar":
+		t := common.TextType()
+		t.Max = length()
+		t.KeepMax = true
+		return t
+	case "character", "char":
+		t := common.PaddedTextType()
+		t.Max = length()
+		return t
+	case "bytea":
+		return common.BlobType()
+	case "date":
+		return common.DateType()
+	case "time", "time without time zone":
+		return common.TimeType()
+	case "timestamp", "timestamp without time zone":
+		return common.TimestampType()
+	case "timestamptz", "timestamp with time zone":
+		return common.TimestampTzType()
+	case "interval":
+		return common.IntervalType()
+	case "json", "jsonb":
+		return common.JsonType()
+	}
+
+	return nil
 }
 
 func GenericToPostgresType(genericType *common.Type) string {
@@ -25,7 +92,7 @@ func GenericToPostgresType(genericType *common.Type) string {
 	case common.TypeText:
 		/* the typical varchar type if its maximum is lower than 200, we
 		 * assume they actually meant it */
-		if gen.HasMax() && max < 200 {
+		if gen.HasMax() && (max < 200 || gen.KeepMax) {
 			return fmt.Sprintf("character varying(%v)", max)
 		}
 
@@ -38,6 +105,9 @@ func GenericToPostgresType(genericType *common.Type) string {
 	case common.TypeDouble:
 		return "double precision"
 	case common.TypeNumeric:
+		if precision == 0 {
+			return "numeric"
+		}
 		return fmt.Sprintf("numeric(%v, %v)", precision, scale)
 	case common.TypeBit:
 		return fmt.Sprintf("bit varying(%v)", max)
@@ -57,50 +127,581 @@ func GenericToPostgresType(genericType *common.Type) string {
 		default:
 			return "integer"
 		}
+	case common.TypeTimeStampTz:
+		return "timestamp with time zone"
+	case common.TypeInterval:
+		return "interval"
+	case common.TypeGeometry:
+		if gen.Srid != 0 {
+			return fmt.Sprintf("geometry(%v, %v)", postgisSubtype(gen.Subtype), gen.Srid)
+		}
+		return fmt.Sprintf("geometry(%v)", postgisSubtype(gen.Subtype))
 	case common.TypeSet:
 		return "text[]"
 	case common.TypeJson:
-		return "json"
+		return "jsonb"
+	case common.TypeEnum:
+		/* enum columns that are turned into a type use columnTypeSql */
+		return "text"
+	case common.TypeDeclared:
+		return gen.Subtype
 	default:
 		return name
 	}
 }
 
+/* the name postgis uses for a kind of geometry */
+func postgisSubtype(subtype string) string {
+	switch subtype {
+	case "point":
+		return "Point"
+	case "linestring":
+		return "LineString"
+	case "polygon":
+		return "Polygon"
+	case "multipoint":
+		return "MultiPoint"
+	case "multilinestring":
+		return "MultiLineString"
+	case "multipolygon":
+		return "MultiPolygon"
+	case "geometrycollection", "geomcollection":
+		return "GeometryCollection"
+	default:
+		return "Geometry"
+	}
+}
+
 /* converts a RawBytes field into something you can
  * put into a regular insert statement (wrapping strings in $$
  * et cetera) */
-func RawToPostgres(val []byte, origType *common.Type) (string, error) {
+func RawToPostgres(val []byte, col *common.Column) (string, error) {
 	if val == nil {
 		return "NULL", nil
 	}
-	switch origType.Name {
-	case common.TypeText, common.TypeChar, common.TypeJson:
+	if col.Mask != "" {
+		masked, null := common.MaskValue(string(val), col)
+		if null {
+			return "NULL", nil
+		}
+		val = []byte(masked)
+	}
+	if isTextType(col.Type.Name) {
+		var err error
+		if val, err = Sanitize(val, col); err != nil {
+			return "", err
+		}
+	}
+
+	switch col.Type.Name {
+	case common.TypeText, common.TypeChar:
+		return "'" + AssemblyString([]byte(repairText(string(val), col))) + "'", nil
+	case common.TypeEnum:
 		return "'" + AssemblyString(val) + "'", nil
+	case common.TypeJson:
+		s, null, err := ValidJson(string(val), col)
+		if err != nil || null {
+			return "NULL", err
+		}
+		return "'" + AssemblyString([]byte(s)) + "'", nil
 	case common.TypeBool, common.TypeTinyint:
-		/* ascii(48) = "0" and ascii(49) = "1" */
+		if len(val) == 0 {
+			return "", fmt.Errorf("postgres: empty bool value in column %v.%v", col.TableName, col.Name)
+		}
+		if !strings.HasPrefix(col.RawType, "tinyint") && !strings.HasPrefix(col.RawType, "bit") {
+			/* a column declared as boolean, postgres makes sense of
+			 * 't', 'yes', 'true', ... */
+			return "'" + AssemblyString(val) + "'", nil
+		}
+		/* ascii(48) = "0" and ascii(49) = "1", a bit(1) arrives as the
+		 * byte 0 or 1 */
 		switch val[0] {
-		case 48:
+		case 0, 48:
 			return "FALSE", nil
-		case 49:
+		case 1, 49:
 			return "TRUE", nil
 		default:
 			return "", fmt.Errorf("postgres: did not recognize bool value: string(%v) = %v, val[0] = %v", val, string(val), val[0])
 		}
 	case common.TypeNumeric, common.TypeInteger, common.TypeFloat, common.TypeDouble:
 		return string(val), nil
-	case common.TypeTimeStamp, common.TypeTime, common.TypeDate:
+	case common.TypeTimeStamp, common.TypeTimeStampTz, common.TypeTime, common.TypeDate, common.TypeInterval:
+		/* MySQL TIME values ([-]838:59:59 at most) are valid interval
+		 * input as they are */
 		s := AssemblyString(val)
-		if s == "0000-00-00 00:00:00" {
-			s = time.Now().Format(time.RFC3339)
+		if col.Type.Name != common.TypeTime && IsZeroDate(s) {
+			repl, null, err := ZeroDate(s, col)
+			if err != nil || null {
+				return "NULL", err
+			}
+			s = repl
 		}
-		return "'" + s + "'", nil
+		return "'" + withZone(s, col) + "'", nil
 	case common.TypeBlob:
-		return "E''", nil
+		return ByteaLiteral(val), nil
+	case common.TypeBit:
+		return "B'" + BitString(val, col.Type.Max) + "'", nil
+	case common.TypeGeometry:
+		srid, wkb, err := SplitSridWkb(val)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("ST_GeomFromWKB(%v::bytea, %v)", ByteaLiteral(wkb), srid), nil
+	case common.TypeSet:
+		return "'" + AssemblyString([]byte(SetToArray(string(val)))) + "'", nil
+	case common.TypeDeclared:
+		/* an untyped literal, postgres casts it to the declared type */
+		return "'" + AssemblyString(val) + "'", nil
 	default:
 		return string(val), nil
 	}
 }
 
+/* converts a value scanned into the slice from NewTypedSlice into
+ * something the bulk (COPY) path can send for the column */
+func TypedToPostgres(val interface{}, col *common.Column) (interface{}, error) {
+	/* masked columns are always scanned as strings */
+	if col.Mask != "" {
+		if s, valid, ok := scannedString(val); ok && valid {
+			masked, null := common.MaskValue(s, col)
+			if null {
+				return nil, nil
+			}
+			val = &masked
+		}
+	}
+	if isTextType(col.Type.Name) {
+		if s, valid, ok := scannedString(val); ok && valid {
+			clean, err := Sanitize([]byte(s), col)
+			if err != nil {
+				return nil, err
+			}
+			s = string(clean)
+			val = &s
+		}
+	}
+
+	switch col.Type.Name {
+	case common.TypeBlob:
+		/* a nil slice would be sent as an empty bytea instead of NULL */
+		if v, ok := val.(*[]byte); ok && *v == nil {
+			return nil, nil
+		}
+	case common.TypeBit:
+		if v, ok := val.(*[]byte); ok {
+			if *v == nil {
+				return nil, nil
+			}
+			return BitString(*v, col.Type.Max), nil
+		}
+	case common.TypeBool:
+		if v, ok := val.(*[]byte); ok {
+			if *v == nil {
+				return nil, nil
+			}
+			return len(*v) > 0 && (*v)[0] == 1, nil
+		}
+	case common.TypeGeometry:
+		/* COPY can't call ST_GeomFromWKB, but postgis accepts hex EWKB */
+		if v, ok := val.(*[]byte); ok {
+			if *v == nil {
+				return nil, nil
+			}
+			srid, wkb, err := SplitSridWkb(*v)
+			if err != nil {
+				return nil, err
+			}
+			return WkbToEwkbHex(wkb, srid)
+		}
+	case common.TypeText, common.TypeChar:
+		if s, valid, ok := scannedString(val); ok && valid {
+			return repairText(s, col), nil
+		}
+	case common.TypeSet:
+		if s, valid, ok := scannedString(val); ok {
+			if !valid {
+				return nil, nil
+			}
+			return SetToArray(s), nil
+		}
+	case common.TypeJson:
+		if s, valid, ok := scannedString(val); ok && valid {
+			s, null, err := ValidJson(s, col)
+			if err != nil || null {
+				return nil, err
+			}
+			return s, nil
+		}
+	case common.TypeTimeStamp, common.TypeTimeStampTz, common.TypeDate:
+		if s, valid, ok := scannedString(val); ok && valid {
+			if IsZeroDate(s) {
+				repl, null, err := ZeroDate(s, col)
+				if err != nil || null {
+					return nil, err
+				}
+				s = repl
+			}
+			return withZone(s, col), nil
+		}
+	}
+
+	return val, nil
+}
+
+/* whether values of the type are text, postgres has some demands on text */
+func isTextType(name string) bool {
+	switch name {
+	case common.TypeText, common.TypeChar, common.TypeEnum, common.TypeSet, common.TypeJson, common.TypeDeclared:
+		return true
+	}
+	return false
+}
+
+/* postgres rejects NUL bytes and invalid UTF-8 in text, depending on the
+ * sanitize policy of the column they are stripped, replaced by U+FFFD or
+ * the transfer fails */
+func Sanitize(val []byte, col *common.Column) ([]byte, error) {
+	if bytes.IndexByte(val, 0) < 0 && utf8.Valid(val) {
+		return val, nil
+	}
+
+	var repl []byte
+	switch col.Sanitize {
+	case common.SanitizeFail:
+		return nil, fmt.Errorf("postgres: NUL byte or invalid UTF-8 in column %v.%v: %q",
+			col.TableName, col.Name, abbreviate(string(val), 64))
+	case common.SanitizeStrip:
+	default:
+		repl = []byte(string(utf8.RuneError))
+	}
+
+	clean := make([]byte, 0, len(val))
+	for len(val) > 0 {
+		r, size := utf8.DecodeRune(val)
+		if r == 0 || (r == utf8.RuneError && size == 1) {
+			clean = append(clean, repl...)
+		} else {
+			clean = append(clean, val[:size]...)
+		}
+		val = val[size:]
+	}
+
+	col.CountChange("values sanitized")
+	return clean, nil
+}
+
+/* returns the string inside a *string or *sql.NullString from
+ * NewTypedSlice, valid is false for NULL and ok is false if val is not a
+ * string container */
+func scannedString(val interface{}) (s string, valid bool, ok bool) {
+	switch v := val.(type) {
+	case *sql.NullString:
+		return v.String, v.Valid, true
+	case *string:
+		return *v, true, true
+	}
+	return "", false, false
+}
+
+/* repairs double-encoded text if the column asks for it */
+func repairText(s string, col *common.Column) string {
+	if !col.RepairEncoding {
+		return s
+	}
+
+	repaired, ok := common.RepairDoubleEncoding(s)
+	if ok {
+		col.CountChange("double-encoded values repaired")
+	}
+	return repaired
+}
+
+/* checks that s is a valid JSON document, if it isn't the invalid json
+ * policy of the column decides the replacement, null = true means the
+ * value should become NULL */
+func ValidJson(s string, col *common.Column) (repl string, null bool, err error) {
+	/* jsonb can't hold \u0000, even though it is valid JSON */
+	if json.Valid([]byte(s)) && !hasNulEscape(s) {
+		return s, false, nil
+	}
+
+	switch col.InvalidJson {
+	case common.InvalidJsonNull:
+		null = true
+	case common.InvalidJsonWrap:
+		/* store the document as a JSON string */
+		wrapped, err := json.Marshal(s)
+		if err != nil {
+			return "", false, err
+		}
+		repl = string(wrapped)
+	default:
+		return "", false, fmt.Errorf("postgres: invalid JSON in column %v.%v: %v",
+			col.TableName, col.Name, abbreviate(s, 64))
+	}
+
+	col.CountChange("invalid JSON documents replaced")
+	return repl, null, nil
+}
+
+/* whether the JSON document s contains the escape \u0000 */
+func hasNulEscape(s string) bool {
+	for i := 0; i < len(s)-1; i++ {
+		if s[i] != '\\' {
+			continue
+		}
+		if s[i+1] == 'u' && strings.HasPrefix(s[i+2:], "0000") {
+			return true
+		}
+		/* skip the escaped character, it might be a backslash */
+		i++
+	}
+	return false
+}
+
+/* cuts s to at most n characters, large or sensitive values shouldn't end
+ * up in error messages as a whole */
+func abbreviate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "..."
+}
+
+/* appends the time zone of the column to a timestamptz value, so postgres
+ * knows which point in time is meant */
+func withZone(s string, col *common.Column) string {
+	if col.Type.Name != common.TypeTimeStampTz || col.Zone == "" {
+		return s
+	}
+	return s + " " + col.Zone
+}
+
+/* whether a MySQL date or datetime has a zero year, month or day, which
+ * postgres doesn't accept */
+func IsZeroDate(s string) bool {
+	if len(s) < 10 || s[4] != '-' || s[7] != '-' {
+		return false
+	}
+	return s[0:4] == "0000" || s[5:7] == "00" || s[8:10] == "00"
+}
+
+/* applies the zero date policy of the column, returns the replacement
+ * value, or null = true if the value should become NULL */
+func ZeroDate(s string, col *common.Column) (repl string, null bool, err error) {
+	switch col.ZeroDate {
+	case common.ZeroDateFail:
+		return "", false, fmt.Errorf("postgres: zero date %v in column %v.%v", s, col.TableName, col.Name)
+	case common.ZeroDateEpoch:
+		repl = epoch(col)
+	case "", common.ZeroDateNull:
+		if col.Null {
+			null = true
+			break
+		}
+		/* NULL doesn't fit a NOT NULL column, the epoch does */
+		if col.Changes["zero dates replaced"] == 0 {
+			log.Printf("WARNING: postgres: zero date in NOT NULL column %v.%v, using %v instead of NULL",
+				col.TableName, col.Name, epoch(col))
+		}
+		repl = epoch(col)
+	default:
+		repl = col.ZeroDate
+	}
+
+	col.CountChange("zero dates replaced")
+	return repl, null, nil
+}
+
+func epoch(col *common.Column) string {
+	if col.Type.Name == common.TypeDate {
+		return "1970-01-01"
+	}
+	return "1970-01-01 00:00:00"
+}
+
+/* encodes binary data as a bytea literal in hex format: '\xdeadbeef', the
+ * literal is built in a single allocation as blobs can be large */
+func ByteaLiteral(val []byte) string {
+	lit := make([]byte, 3+hex.EncodedLen(len(val))+1)
+	copy(lit, `'\x`)
+	hex.Encode(lit[3:], val)
+	lit[len(lit)-1] = '\''
+	return string(lit)
+}
+
+/* formats the big-endian bytes MySQL sends for a BIT(n) value as n zeroes
+ * and ones, if n is 0 all bits are returned */
+func BitString(val []byte, n uint) string {
+	bits := make([]byte, 0, len(val)*8)
+	for _, b := range val {
+		for i := 7; i >= 0; i-- {
+			bits = append(bits, '0'+(b>>uint(i))&1)
+		}
+	}
+
+	switch {
+	case n == 0:
+		return string(bits)
+	case int(n) <= len(bits):
+		return string(bits[len(bits)-int(n):])
+	default:
+		return strings.Repeat("0", int(n)-len(bits)) + string(bits)
+	}
+}
+
+/* the source selects geometries as WKB prefixed with their SRID (4 bytes,
+ * big-endian) */
+func SplitSridWkb(val []byte) (uint, []byte, error) {
+	if len(val) < 4 {
+		return 0, nil, fmt.Errorf("postgres: invalid geometry value of %v bytes", len(val))
+	}
+	return uint(binary.BigEndian.Uint32(val[:4])), val[4:], nil
+}
+
+/* converts WKB into hex encoded EWKB, which postgis accepts as text
+ * input and which, unlike WKB, carries the SRID */
+func WkbToEwkbHex(wkb []byte, srid uint) (string, error) {
+	/* byte order (1 byte) + geometry type (4 bytes) */
+	if len(wkb) < 5 {
+		return "", fmt.Errorf("postgres: invalid WKB value of %v bytes", len(wkb))
+	}
+	if srid == 0 {
+		return hex.EncodeToString(wkb), nil
+	}
+
+	var order binary.ByteOrder = binary.BigEndian
+	if wkb[0] == 1 {
+		order = binary.LittleEndian
+	}
+
+	/* the SRID flag is set in the geometry type, the SRID follows it */
+	ewkb := make([]byte, 9, len(wkb)+4)
+	ewkb[0] = wkb[0]
+	order.PutUint32(ewkb[1:5], order.Uint32(wkb[1:5])|0x20000000)
+	order.PutUint32(ewkb[5:9], uint32(srid))
+	ewkb = append(ewkb, wkb[5:]...)
+
+	return hex.EncodeToString(ewkb), nil
+}
+
+/* converts the comma-separated value of a MySQL SET into a postgres array
+ * literal, e.g. a,b becomes {"a","b"} */
+func SetToArray(val string) string {
+	if val == "" {
+		return "{}"
+	}
+
+	members := strings.Split(val, ",")
+	for i, member := range members {
+		member = strings.Replace(member, `\`, `\\`, -1)
+		member = strings.Replace(member, `"`, `\"`, -1)
+		members[i] = `"` + member + `"`
+	}
+	return "{" + strings.Join(members, ",") + "}"
+}
+
+/* translates the default value of a source column into an expression
+ * postgres understands, returns false if the column has no default or if
+ * it can't be expressed (a warning is logged in that case) */
+func DefaultToPostgres(col *common.Column) (string, bool) {
+	var val string
+	switch d := col.Default.(type) {
+	case sql.NullString:
+		if !d.Valid {
+			return "", false
+		}
+		val = d.String
+	case string:
+		val = d
+	default:
+		return "", false
+	}
+
+	warn := func() (string, bool) {
+		log.Printf("WARNING: postgres: can't express default value %v of column %v.%v (%v), leaving it out",
+			val, col.TableName, col.Name, col.RawType)
+		return "", false
+	}
+
+	/* expression defaults (MySQL >= 8.0.13) are in MySQL's dialect */
+	if col.DefaultExpr {
+		return warn()
+	}
+
+	switch col.Type.Name {
+	case common.TypeTimeStamp, common.TypeTimeStampTz, common.TypeDate, common.TypeTime, common.TypeInterval:
+		upper := strings.ToUpper(val)
+		switch {
+		case strings.HasPrefix(upper, "CURRENT_TIMESTAMP"), strings.HasPrefix(upper, "NOW("),
+			strings.HasPrefix(upper, "LOCALTIMESTAMP"), strings.HasPrefix(upper, "LOCALTIME"):
+			switch col.Type.Name {
+			case common.TypeDate:
+				return "CURRENT_DATE", true
+			case common.TypeTime:
+				return "CURRENT_TIME", true
+			}
+			return "CURRENT_TIMESTAMP", true
+		case IsZeroDate(val):
+			return warn()
+		}
+		return "'" + AssemblyString([]byte(withZone(val, col))) + "'", true
+	case common.TypeBool, common.TypeTinyint:
+		switch val {
+		case "0", "b'0'":
+			return "FALSE", true
+		case "1", "b'1'":
+			return "TRUE", true
+		}
+		return warn()
+	case common.TypeBit:
+		bits, ok := mysqlBitLiteral(val)
+		if !ok {
+			return warn()
+		}
+		return "B'" + bits + "'", true
+	case common.TypeInteger, common.TypeNumeric, common.TypeFloat, common.TypeDouble:
+		if _, err := strconv.ParseFloat(val, 64); err != nil {
+			return warn()
+		}
+		return val, true
+	case common.TypeBlob:
+		return warn()
+	case common.TypeSet:
+		return "'" + AssemblyString([]byte(SetToArray(val))) + "'", true
+	default:
+		return "'" + AssemblyString([]byte(val)) + "'", true
+	}
+}
+
+/* parses the way MySQL shows a bit default (b'101' or a plain integer) into
+ * a string of zeroes and ones */
+func mysqlBitLiteral(val string) (string, bool) {
+	if strings.HasPrefix(val, "b'") && strings.HasSuffix(val, "'") {
+		bits := val[2 : len(val)-1]
+		if strings.Trim(bits, "01") != "" {
+			return "", false
+		}
+		return bits, true
+	}
+
+	n, err := strconv.ParseUint(val, 10, 64)
+	if err != nil {
+		return "", false
+	}
+	return strconv.FormatUint(n, 2), true
+}
+
+/* a comma-separated list of quoted literals, e.g. 'a', 'b' */
+func quotedList(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, val := range values {
+		quoted = append(quoted, "'"+AssemblyString([]byte(val))+"'")
+	}
+	return strings.Join(quoted, ", ")
+}
+
 func AssemblyString(body []byte) string {
 	s := string(body)
 	s = strings.Replace(s, "'", "''", -1)
@@ -110,28 +711,52 @@ func AssemblyString(body []byte) string {
 func NewTypedSlice(src *common.Table) []interface{} {
 	vals := make([]interface{}, len(src.Columns))
 	for i, col := range src.Columns {
+		if col.Mask != "" {
+			/* masks work on the text of the values */
+			vals[i] = new(sql.NullString)
+			continue
+		}
+
 		switch col.Type.Name {
 		case common.TypeBool, common.TypeTinyint:
-			if col.Null {
+			/* the driver can't turn the bytes of a bit(1) into a bool */
+			if strings.HasPrefix(col.RawType, "bit") {
+				vals[i] = new([]byte)
+			} else if col.Null {
 				vals[i] = new(sql.NullBool)
 			} else {
 				vals[i] = new(bool)
 			}
-		case common.TypeNumeric, common.TypeFloat, common.TypeDouble:
+		case common.TypeNumeric:
+			/* decimals are carried as their exact textual representation,
+			 * a float64 would lose precision */
+			if col.Null {
+				vals[i] = new(sql.NullString)
+			} else {
+				vals[i] = new(string)
+			}
+		case common.TypeFloat, common.TypeDouble:
 			if col.Null {
 				vals[i] = new(sql.NullFloat64)
 			} else {
 				vals[i] = new(float64)
 			}
 		case common.TypeInteger:
-			if col.Null {
+			/* bigint unsigned doesn't fit an int64 */
+			if col.Type.Modifier == common.TypeHuge {
+				if col.Null {
+					vals[i] = new(sql.NullString)
+				} else {
+					vals[i] = new(string)
+				}
+			} else if col.Null {
 				vals[i] = new(sql.NullInt64)
 			} else {
 				vals[i] = new(int64)
 			}
-		case common.TypeBlob:
-			/* do we have a suitable NullBlob or NullByte somewhere? I bet
-			 * this gives problems somehow with NULLable blob fields... */
+		case common.TypeBlob, common.TypeGeometry, common.TypeBit:
+			/* NULL scans into a nil slice, TypedToPostgres turns that
+			 * back into NULL */
 			vals[i] = new([]byte)
 		default:
 			if col.Null {
@@ -0,0 +1,133 @@
+package postgres
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/barnettzqg/gomig/db/common"
+)
+
+/* MySQL TIME values range from -838:59:59 to 838:59:59, interval takes
+ * them as they are */
+func TestIntervalConversion(t *testing.T) {
+	col := &common.Column{TableName: "t", Name: "c", Type: common.IntervalType(), Null: true}
+	if got := GenericToPostgresType(col.Type); got != "interval" {
+		t.Errorf("GenericToPostgresType(interval) = %v", got)
+	}
+
+	for _, val := range []string{"00:00:00", "12:34:56", "838:59:59", "-838:59:59", "-00:00:01", "01:02:03.456789"} {
+		got, err := RawToPostgres([]byte(val), col)
+		if err != nil || got != "'"+val+"'" {
+			t.Errorf("RawToPostgres(%q) = %v, %v", val, got, err)
+		}
+
+		typed, err := TypedToPostgres(&sql.NullString{String: val, Valid: true}, col)
+		if s, valid, ok := scannedString(typed); err != nil || !ok || !valid || s != val {
+			t.Errorf("TypedToPostgres(%q) = %v, %v", val, typed, err)
+		}
+	}
+
+	if got, err := RawToPostgres(nil, col); err != nil || got != "NULL" {
+		t.Errorf("RawToPostgres(nil) = %v, %v", got, err)
+	}
+}
+
+/* declared types convert their values as the type they declare */
+func TestPostgresToGenericType(t *testing.T) {
+	tests := []struct {
+		declared string
+		want     string /* GenericToPostgresType of the generic type */
+	}{
+		{"boolean", "bool"},
+		{"smallint", "smallint"},
+		{"INTEGER", "integer"},
+		{"bigint", "bigint"},
+		{"numeric(12,2)", "numeric(12, 2)"},
+		{"numeric", "numeric"},
+		{"double precision", "double precision"},
+		{"text", "text"},
+		{"varchar(500)", "character varying(500)"},
+		{"character(2)", "character(2)"},
+		{"bytea", "bytea"},
+		{"timestamp with time zone", "timestamp with time zone"},
+		{"timestamptz", "timestamp with time zone"},
+		{"interval", "interval"},
+		{"jsonb", "jsonb"},
+	}
+
+	for _, tt := range tests {
+		gen := PostgresToGenericType(tt.declared)
+		if gen == nil {
+			t.Errorf("PostgresToGenericType(%q) = nil", tt.declared)
+			continue
+		}
+		if got := GenericToPostgresType(gen); got != tt.want {
+			t.Errorf("PostgresToGenericType(%q) gives %v, want %v", tt.declared, got, tt.want)
+		}
+	}
+
+	for _, declared := range []string{"uuid", "money", "inet"} {
+		if gen := PostgresToGenericType(declared); gen != nil {
+			t.Errorf("PostgresToGenericType(%q) = %+v, want nil", declared, gen)
+		}
+	}
+}
+
+func TestDeclaredTypeValues(t *testing.T) {
+	tests := []struct {
+		raw, declared, val, want string
+	}{
+		{"bit(1)", "boolean", "\x01", "TRUE"},
+		{"tinyint(4)", "boolean", "0", "FALSE"},
+		{"varchar(5)", "boolean", "t", "'t'"},
+		{"char(1)", "boolean", "Y", "'Y'"},
+		{"blob", "bytea", "\xde\xad", `'\xdead'`},
+		{"datetime", "timestamptz", "0000-00-00 00:00:00", "NULL"},
+		{"datetime", "timestamptz", "2020-01-02 03:04:05", "'2020-01-02 03:04:05'"},
+	}
+
+	for _, tt := range tests {
+		col := &common.Column{TableName: "t", Name: "c", RawType: tt.raw, Null: true,
+			Type: PostgresToGenericType(tt.declared), DstType: tt.declared}
+		if got, err := RawToPostgres([]byte(tt.val), col); err != nil || got != tt.want {
+			t.Errorf("RawToPostgres(%q) as %v = %v, %v, want %v", tt.val, tt.declared, got, err, tt.want)
+		}
+	}
+
+	col := &common.Column{TableName: "t", Name: "c", RawType: "varchar(5)", Null: true,
+		Type: common.BoolType(), DstType: "boolean"}
+	if got, err := RawToPostgres([]byte{}, col); err == nil {
+		t.Errorf("RawToPostgres of an empty value = %v, want an error", got)
+	}
+}
+
+/* geometries keep the SRID they are selected with */
+func TestGeometryValues(t *testing.T) {
+	col := &common.Column{TableName: "t", Name: "c", Type: common.GeometryType("point"), Null: true}
+	val := []byte{0x00, 0x00, 0x10, 0xe6, 0xde, 0xad}
+	if got, err := RawToPostgres(val, col); err != nil || got != `ST_GeomFromWKB('\xdead'::bytea, 4326)` {
+		t.Errorf("RawToPostgres(%q) = %v, %v", val, got, err)
+	}
+	if got, err := RawToPostgres([]byte{0x01}, col); err == nil {
+		t.Errorf("RawToPostgres of a short value = %v, want an error", got)
+	}
+}
+
+/* only the schema given with the table qualifies it, dots in MySQL table
+ * names are part of the name */
+func TestQualifiedTableNames(t *testing.T) {
+	idx := &common.Index{Name: "idx", Columns: []string{"c"}}
+	tests := []struct {
+		schema, name, want string
+	}{
+		{"", "orders.2020", `CREATE INDEX IF NOT EXISTS "orders.2020_idx" ON "orders.2020" ("c");` + "\n"},
+		{"sales", "orders", `CREATE INDEX IF NOT EXISTS "orders_idx" ON "sales"."orders" ("c");` + "\n"},
+	}
+
+	for _, tt := range tests {
+		src := &common.Table{Name: tt.name, DstSchema: tt.schema}
+		if got := IndexSql(idx, src, tt.name); got != tt.want {
+			t.Errorf("IndexSql on %v.%v = %v, want %v", tt.schema, tt.name, got, tt.want)
+		}
+	}
+}
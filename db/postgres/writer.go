@@ -11,6 +11,10 @@ import (
 
 var PG_W_VERBOSE = true
 
+/* an INSERT is flushed when its values exceed this many bytes, even if it
+ * has less rows than the bulk limit, so big blobs don't pile up in memory */
+const insertByteLimit = 16 << 20
+
 var (
 	postgresInit = []string{
 		"SET client_encoding = 'UTF8';",
@@ -44,6 +48,19 @@ WHERE  col.table_name = '%v'
 ORDER BY col.ordinal_position;`
 )
 
+func quote(name string) string {
+	return common.QuoteIdentifier("postgres", name)
+}
+
+/* quotes the name of a table or type, qualified by its schema unless that
+ * is empty */
+func quoteTable(schema, name string) string {
+	if schema != "" {
+		return quote(schema) + "." + quote(name)
+	}
+	return quote(name)
+}
+
 type genericPostgresWriter struct {
 	e               common.Executor
 	insertBulkLimit int
@@ -52,12 +69,13 @@ type genericPostgresWriter struct {
 func (w *genericPostgresWriter) bulkTransfer(src *common.Table, dstName string, rows *sql.Rows) (err error) {
 	ex := w.e
 
+	/* CopyIn quotes the names itself */
 	colnames := make([]string, 0, len(src.Columns))
 	for _, col := range src.Columns {
-		colnames = append(colnames, col.Name)
+		colnames = append(colnames, col.Destination())
 	}
 
-	if err = ex.BulkInit(dstName, colnames...); err != nil {
+	if err = ex.BulkInit(src.DstSchema, dstName, colnames...); err != nil {
 		return
 	}
 	defer func() {
@@ -71,13 +89,20 @@ func (w *genericPostgresWriter) bulkTransfer(src *common.Table, dstName string,
 	/* create a slice with the right types to extract into, and let the SQL
 	 * driver take care of the conversion */
 	vals := NewTypedSlice(src)
+	args := make([]interface{}, len(vals))
 
 	for rows.Next() {
 		if err = rows.Scan(vals...); err != nil {
 			return fmt.Errorf("postgres: error while reading from source: %v", err)
 		}
 
-		if err = ex.BulkAddRecord(vals...); err != nil {
+		for i, col := range src.Columns {
+			if args[i], err = TypedToPostgres(vals[i], col); err != nil {
+				return err
+			}
+		}
+
+		if err = ex.BulkAddRecord(args...); err != nil {
 			return fmt.Errorf("postgres: error during bulk insert: %v", err)
 		}
 	}
@@ -95,13 +120,14 @@ func (w *genericPostgresWriter) normalTransfer(src *common.Table, dstName string
 	}
 	stringrep := make([]string, 0, len(src.Columns))
 	insertLines := make([]string, 0, 32)
+	insertBytes := 0
 
 	var columns string
 	for _, idx := range src.Columns {
 		if columns == "" {
-			columns += "\"" + idx.Name + "\""
+			columns += quote(idx.Destination())
 		} else {
-			columns += ",\"" + idx.Name + "\""
+			columns += "," + quote(idx.Destination())
 		}
 	}
 	for rows.Next() {
@@ -111,29 +137,32 @@ func (w *genericPostgresWriter) normalTransfer(src *common.Table, dstName string
 			return err
 		}
 		for idx, val := range containers {
-			str, err := RawToPostgres(val, src.Columns[idx].Type)
+			str, err := RawToPostgres(val, src.Columns[idx])
 			if err != nil {
 				return err
 			}
 			stringrep = append(stringrep, str)
 		}
 
-		insertLines = append(insertLines, "("+strings.Join(stringrep, ",")+")")
+		line := "(" + strings.Join(stringrep, ",") + ")"
+		insertLines = append(insertLines, line)
+		insertBytes += len(line)
 		stringrep = stringrep[:0]
 
-		if len(insertLines) >= w.insertBulkLimit {
+		if len(insertLines) >= w.insertBulkLimit || insertBytes >= insertByteLimit {
 			err = w.e.Submit(fmt.Sprintf("INSERT INTO %v(%s) VALUES\n\t%v;\n",
-				dstName, columns, strings.Join(insertLines, ",\n\t")))
+				quoteTable(src.DstSchema, dstName), columns, strings.Join(insertLines, ",\n\t")))
 			if err != nil {
 				return err
 			}
 			insertLines = insertLines[:0]
+			insertBytes = 0
 		}
 	}
 
 	if len(insertLines) > 0 {
 		err := w.e.Submit(fmt.Sprintf("INSERT INTO %v(%s) VALUES\n\t%v;\n",
-			dstName, columns, strings.Join(insertLines, ",\n\t")))
+			quoteTable(src.DstSchema, dstName), columns, strings.Join(insertLines, ",\n\t")))
 		if err != nil {
 			return err
 		}
@@ -173,12 +202,12 @@ func (w *genericPostgresWriter) transferTable(src *common.Table, dstName string,
 
 	return rows.Err()
 }
-func (w *genericPostgresWriter) ClearTable(tables []string) {
+func (w *genericPostgresWriter) ClearTable(tables []*common.Table) {
 	if err := w.e.Begin("clear table"); err != nil {
 		fmt.Println(err.Error())
 	}
 	for _, table := range tables {
-		w.e.Submit(fmt.Sprintf("drop table %s;", table))
+		w.e.Submit(fmt.Sprintf("drop table %s;", quoteTable(table.DstSchema, table.Destination())))
 	}
 	if err := w.e.Commit(); err != nil {
 		fmt.Println(err.Error())
@@ -194,23 +223,80 @@ func (w *genericPostgresWriter) MergeTable(src *common.Table, dstName, extraDstC
 		return err
 	}
 
+	/* geometry columns need postgis */
+	for _, col := range src.Columns {
+		if col.Type.Name == common.TypeGeometry {
+			if err := w.e.Submit("CREATE EXTENSION IF NOT EXISTS postgis;\n"); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	/* case-insensitive columns need citext or their collation */
+	for _, stmt := range collationSql(src) {
+		if err := w.e.Submit(stmt); err != nil {
+			return err
+		}
+	}
+
+	/* enum columns might need their type to exist beforehand */
+	for _, col := range src.Columns {
+		if usesEnumType(col) {
+			if err := w.e.Submit(EnumTypeSql(src.DstSchema, dstName, col)); err != nil {
+				return err
+			}
+		}
+	}
+
 	/* create temporary table */
-	tempTableQ := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v (\n\t%v\n);\n", dstName, ColumnsSql(src))
+	tempTableQ := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %v (\n\t%v\n);\n", quoteTable(src.DstSchema, dstName), ColumnsSql(src, dstName))
 	if err := w.e.Submit(tempTableQ); err != nil {
 		return err
 	}
 
+	for _, idx := range src.Indexes {
+		if err := w.e.Submit(IndexSql(idx, src, dstName)); err != nil {
+			return err
+		}
+	}
+
 	if PG_W_VERBOSE {
 		log.Println("postgres: preparing to read values from source db")
 	}
 
+	/* added columns are filled in by their default, which only lasts
+	 * for the load so later inserts of applications don't get it */
+	for _, add := range src.Added {
+		if err := w.e.Submit(AddedDefaultSql(src.DstSchema, dstName, add, true)); err != nil {
+			return err
+		}
+	}
+
 	if err := w.transferTable(src, dstName, r); err != nil {
 		return err
 	}
 
+	for _, add := range src.Added {
+		if err := w.e.Submit(AddedDefaultSql(src.DstSchema, dstName, add, false)); err != nil {
+			return err
+		}
+	}
+
 	if PG_W_VERBOSE {
 		log.Print("postgres: rowscan done, creating merge statements")
 	}
+
+	/* make sure new inserts don't collide with the migrated ids */
+	for _, col := range src.Columns {
+		if !col.AutoIncr {
+			continue
+		}
+		if err := w.e.Submit(SequenceResetSql(src, dstName, col)); err != nil {
+			return err
+		}
+	}
+
 	return w.e.Commit()
 }
 
@@ -279,23 +365,179 @@ func NewPostgresFileWriter(filename string) (*PostgresFileWriter, error) {
 }
 
 //ColumnsSql ColumnsSql
-func ColumnsSql(table *common.Table) string {
+func ColumnsSql(table *common.Table, dstName string) string {
 	colSQL := make([]string, 0, len(table.Columns))
 
 	for _, col := range table.Columns {
-		colSQL = append(colSQL, fmt.Sprintf("%v %v", col.Name, GenericToPostgresType(col.Type)))
+		name := quote(col.Destination())
+		def := fmt.Sprintf("%v %v", name, columnTypeSql(table.DstSchema, dstName, col))
+		if dflt, ok := DefaultToPostgres(col); ok && !col.AutoIncr {
+			def += " DEFAULT " + dflt
+		}
+		if col.DstCollation != "" {
+			def += " COLLATE " + quote(col.DstCollation)
+		}
+		if !col.Null {
+			def += " NOT NULL"
+		}
+		if col.CheckUnsigned && col.Type.Unsigned {
+			def += fmt.Sprintf(" CHECK (%v >= 0)", name)
+		}
+		if col.Type.Name == common.TypeEnum && col.EnumStyle == common.EnumAsCheck {
+			def += fmt.Sprintf(" CHECK (%v IN (%v))", name, quotedList(col.Type.Values))
+		}
+		colSQL = append(colSQL, def)
+	}
+
+	for _, add := range table.Added {
+		colSQL = append(colSQL, fmt.Sprintf("%v %v", quote(add.Name), add.Type))
 	}
 
 	pkCols := make([]string, 0, len(table.Columns))
 	for _, col := range table.Columns {
 		if col.PrimaryKey {
-			pkCols = append(pkCols, col.Name)
+			pkCols = append(pkCols, quote(col.Destination()))
 		}
 	}
 
+	/* keyless tables can get an artificial key, it's filled in by its
+	 * sequence as the data transfer never mentions it */
+	if len(pkCols) == 0 && table.SurrogateKey != "" {
+		colSQL = append(colSQL, fmt.Sprintf("%v bigserial NOT NULL", quote(table.SurrogateKey)))
+		pkCols = append(pkCols, quote(table.SurrogateKey))
+	}
+
 	/* add the primary key */
-	colSQL = append(colSQL, fmt.Sprintf("PRIMARY KEY (%v)",
-		strings.Join(pkCols, ", ")))
+	if len(pkCols) > 0 {
+		colSQL = append(colSQL, fmt.Sprintf("PRIMARY KEY (%v)",
+			strings.Join(pkCols, ", ")))
+	}
 
 	return strings.Join(colSQL, ",\n\t")
 }
+
+/* the type of a column as it appears in CREATE TABLE, including the way
+ * auto-increment values are generated */
+func columnTypeSql(schema, dstName string, col *common.Column) string {
+	pgType := col.DstType
+	switch {
+	case pgType != "":
+		/* declared in the config, taken as it is */
+	case usesEnumType(col):
+		return quoteTable(schema, EnumTypeName(dstName, col))
+	case col.Citext:
+		return "citext"
+	default:
+		pgType = GenericToPostgresType(col.Type)
+	}
+	if !col.AutoIncr {
+		return pgType
+	}
+
+	switch col.AutoIncrStyle {
+	case common.AutoIncrSerial:
+		switch pgType {
+		case "smallint":
+			return "smallserial"
+		case "integer":
+			return "serial"
+		case "bigint":
+			return "bigserial"
+		default:
+			log.Printf("WARNING: postgres: auto-increment column %v.%v of type %v converted to bigserial",
+				col.TableName, col.Name, pgType)
+			return "bigserial"
+		}
+	default:
+		switch pgType {
+		case "smallint", "integer", "bigint":
+		default:
+			log.Printf("WARNING: postgres: auto-increment column %v.%v of type %v converted to bigint",
+				col.TableName, col.Name, pgType)
+			pgType = "bigint"
+		}
+		return pgType + " GENERATED BY DEFAULT AS IDENTITY"
+	}
+}
+
+//SequenceResetSql returns the statement that moves the sequence behind an
+//auto-increment column past both the migrated ids and the source counter
+func SequenceResetSql(src *common.Table, dstName string, col *common.Column) string {
+	/* pg_get_serial_sequence parses the table name as an identifier, but
+	 * takes the column name literally */
+	return fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%v', '%v'), "+
+		"GREATEST((SELECT COALESCE(MAX(%v), 0) + 1 FROM %v), %v), false);\n",
+		AssemblyString([]byte(quoteTable(src.DstSchema, dstName))), AssemblyString([]byte(col.Destination())),
+		quote(col.Destination()), quoteTable(src.DstSchema, dstName), src.AutoIncrement)
+}
+
+/* whether the column is an enum that gets its own type */
+func usesEnumType(col *common.Column) bool {
+	return col.Type.Name == common.TypeEnum && col.EnumStyle != common.EnumAsCheck
+}
+
+//EnumTypeName returns the name of the type that is created for an enum column
+func EnumTypeName(dstName string, col *common.Column) string {
+	return fmt.Sprintf("%v_%v", dstName, col.Destination())
+}
+
+//EnumTypeSql returns the statement that creates the type of an enum column
+//in schema, it does nothing if the type already exists
+func EnumTypeSql(schema, dstName string, col *common.Column) string {
+	return fmt.Sprintf("DO $$ BEGIN\n\tCREATE TYPE %v AS ENUM (%v);\n"+
+		"EXCEPTION WHEN duplicate_object THEN NULL;\nEND $$;\n",
+		quoteTable(schema, EnumTypeName(dstName, col)), quotedList(col.Type.Values))
+}
+
+//AddedDefaultSql sets (or drops) the default that fills in the added
+//column add during the load
+func AddedDefaultSql(schema, dstName string, add *common.AddedColumn, set bool) string {
+	if !set {
+		return fmt.Sprintf("ALTER TABLE %v ALTER COLUMN %v DROP DEFAULT;\n", quoteTable(schema, dstName), quote(add.Name))
+	}
+	return fmt.Sprintf("ALTER TABLE %v ALTER COLUMN %v SET DEFAULT %v;\n",
+		quoteTable(schema, dstName), quote(add.Name), add.Default)
+}
+
+//IndexSql returns the statement that creates idx of the src table on the
+//dstName table, spatial indexes become GIST indexes
+func IndexSql(idx *common.Index, src *common.Table, dstName string) string {
+	method := ""
+	if idx.Spatial {
+		method = " USING GIST"
+	}
+
+	cols := make([]string, 0, len(idx.Columns))
+	for _, name := range idx.Columns {
+		if col := src.Column(name); col != nil {
+			name = col.Destination()
+		}
+		cols = append(cols, quote(name))
+	}
+
+	/* index names are unique per schema in postgres, not per table, the
+	 * index ends up in the schema of its table */
+	return fmt.Sprintf("CREATE INDEX IF NOT EXISTS %v ON %v%v (%v);\n",
+		quote(dstName+"_"+idx.Name), quoteTable(src.DstSchema, dstName), method, strings.Join(cols, ", "))
+}
+
+/* the statements that create what the collations of the columns of table
+ * depend on */
+func collationSql(table *common.Table) []string {
+	var citext, ci bool
+	for _, col := range table.Columns {
+		citext = citext || col.Citext
+		ci = ci || col.DstCollation == common.CollationCaseInsensitive
+	}
+
+	stmts := make([]string, 0, 2)
+	if citext {
+		stmts = append(stmts, "CREATE EXTENSION IF NOT EXISTS citext;\n")
+	}
+	if ci {
+		stmts = append(stmts, fmt.Sprintf("CREATE COLLATION IF NOT EXISTS %v "+
+			"(provider = icu, locale = 'und-u-ks-level2', deterministic = false);\n",
+			common.CollationCaseInsensitive))
+	}
+	return stmts
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/barnettzqg/gomig/db"
+	"github.com/barnettzqg/gomig/db/common"
+)
+
+type DetectEncodingCommand struct {
+	/* config file */
+	File string `short:"f" long:"file" description:"The path of the configuration file to use" default:"config.yml"`
+
+	Rows int `short:"n" long:"rows" description:"The number of rows to sample per table" default:"1000"`
+}
+
+func (x *DetectEncodingCommand) Execute(args []string) error {
+	common.DBEXEC_VERBOSE = false
+
+	conf := LoadConfigOrDie(x.File)
+
+	reader, err := db.OpenReader("mysql", conf.Mysql)
+	if err != nil {
+		return fmt.Errorf("gomig: error while creating reader, %v", err)
+	}
+	defer reader.Close()
+
+	tables := reader.FilteredTables(conf.OnlyTables, conf.ExcludeTables)
+	for _, table := range tables {
+		applySourceOptions(table, conf.Tables[table.Name])
+		counts, sampled, err := detectDoubleEncoding(reader, table, x.Rows)
+		if err != nil {
+			fmt.Printf("%v: ERROR (%v)\n", table.Name, err)
+			continue
+		}
+
+		for _, col := range table.Columns {
+			if counts[col.Name] == 0 {
+				continue
+			}
+			fmt.Printf("%v.%v (%v): %v of %v sampled values look double-encoded\n",
+				table.Name, col.Name, col.Charset, counts[col.Name], sampled)
+		}
+	}
+
+	return nil
+}
+
+/* samples rows of table and counts, per text column, how many values
+ * look like double-encoded UTF-8 */
+func detectDoubleEncoding(r common.Reader, table *common.Table, limit int) (map[string]int, int, error) {
+	counts := make(map[string]int)
+
+	rows, err := r.Sample(table, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	pointers := make([]interface{}, len(table.Columns))
+	containers := make([]sql.RawBytes, len(table.Columns))
+	for i := range pointers {
+		pointers[i] = &containers[i]
+	}
+
+	sampled := 0
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, 0, err
+		}
+		sampled++
+
+		for i, col := range table.Columns {
+			if col.Type.Name != common.TypeText && col.Type.Name != common.TypeChar {
+				continue
+			}
+			if _, ok := common.RepairDoubleEncoding(string(containers[i])); ok {
+				counts[col.Name]++
+			}
+		}
+	}
+
+	return counts, sampled, rows.Err()
+}
+
+func init() {
+	var x DetectEncodingCommand
+	parser.AddCommand("detect-encoding",
+		"Report text columns that look like double-encoded UTF-8 (UTF-8 stored as latin1)",
+		"Report text columns that look like double-encoded UTF-8 (UTF-8 stored as latin1)",
+		&x)
+}
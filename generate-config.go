@@ -17,6 +17,14 @@ mysql:
  password: somepass
  database: somedb
  compress: false
+ # the session time zone, TIMESTAMP columns are read in this zone, can
+ # be a name (needs the MySQL time zone tables) or an offset. If it isn't
+ # given the server's zone is used, or UTC if timezone (below) is true.
+ # With timezone true it has to be an offset, as the repeated hour at the
+ # end of DST is ambiguous in a named zone.
+ timezone: "+00:00"
+ # the connection character set, utf8mb4 handles all of unicode
+ charset: utf8mb4
 
 # if file is given, output goes to file, if postgres parameters
 # are given, output is executed straight on the db, socket is
@@ -47,7 +55,8 @@ projections:
 
 
 # table "a" in the source database has been renamed to table "b"
-# in the destination database
+# in the destination database, "b" can be qualified by a schema
+# (myschema.players)
 table_map:
  pr_players: players
 
@@ -74,8 +83,146 @@ supress_ddl: false
 # if force_truncate is true, forces a table truncate before table loading
 force_truncate: false
 
-# if timezone is true, forces to append/convert to UTC tzinfo mysql data
-timezone: false
+# how the names of tables and columns are written in the destination, all
+# identifiers are quoted so reserved words and special characters work:
+# lowercase (OrderItems -> orderitems), preserve (OrderItems stays
+# OrderItems, which needs quoting in postgres) or snake_case (OrderItems ->
+# order_items). Names from table_map are used as they are.
+naming: lowercase
+
+# how auto-increment columns are created in the destination, either as
+# identity columns (GENERATED BY DEFAULT AS IDENTITY) or as serial columns.
+# After loading, their sequence continues after the highest migrated id.
+auto_increment: identity
+
+# tables without a primary key get an extra bigserial column with this
+# name as their primary key, comment it out to create them without a key
+# surrogate_key: gomig_id
+
+# enum columns become either a separate enum type per column (type) or a
+# text column with a CHECK constraint on the allowed values (check)
+enums: type
+
+# if profile is true, the data of columns whose type can't be trusted is
+# scanned before migrating: tinyint(1) columns that hold more than 0 and 1 become
+# smallint instead of boolean. Mismatches are reported.
+profile: false
+
+# MySQL TIME columns can hold durations (-838:59:59 to 838:59:59) that
+# don't fit postgres' time type, if time_as_interval is true they become
+# interval columns instead
+time_as_interval: false
+
+# text with a binary collation (e.g. utf8mb4_bin) is compared byte by
+# byte, it can become text with the "C" collation (c) or bytea (bytea)
+binary_collation: c
+
+# text with a case-insensitive collation (e.g. utf8mb4_general_ci) becomes
+# case-sensitive text, unless it's mapped to citext (citext) or to a
+# nondeterministic ICU collation (icu)
+# case_insensitive: citext
+
+# if bit_as_bool is true, bit(1) columns become boolean instead of
+# bit varying(1)
+bit_as_bool: false
+
+# unsigned integers are migrated to a type large enough for their range,
+# if unsigned_check is true they also get a CHECK (col >= 0) constraint
+unsigned_check: false
+
+# MySQL zero dates (0000-00-00, 2020-00-15, ...) are invalid in postgres,
+# they can become NULL (null, NOT NULL columns get 1970-01-01 and a
+# warning instead), 1970-01-01 (epoch), abort the migration (fail) or be
+# replaced by a fixed date such as '0001-01-01'. The number of replaced
+# values is printed at the end of the run.
+zero_dates: "null"
+
+# JSON columns become jsonb, values that aren't valid JSON either abort
+# the migration (fail), become NULL (null) or are stored as a JSON string
+# (wrap)
+invalid_json: fail
+
+# postgres doesn't accept NUL bytes or invalid UTF-8 in text, such values
+# can be repaired by replacing the offending bytes with U+FFFD (replace),
+# by removing them (strip) or abort the migration (fail). The number of
+# changed values per column is printed at the end of the run.
+sanitize: replace
+
+# postgres types for columns whose MySQL type (as in information_schema,
+# e.g. "int(10) unsigned") matches a regular expression, they replace the
+# default mapping. The first matching rule wins, the type of a column
+# (see tables below) takes precedence. Values are converted as the postgres
+# type requires, e.g. bit(1) to boolean.
+#type_rules:
+#  - match: ^char\(36\)
+#    type: uuid
+#  - match: ^decimal\(19,4\)
+#    type: money
+
+# the secret the keyed masks of columns (hash, email, phone, name and
+# shift_date, see below) are derived from. The same key masks a value the
+# same way in every table and run, so joins on masked keys still work.
+#mask_key: change-me
+
+# per table settings, the global settings above can be overridden for a
+# table or one of its columns
+#tables:
+#  orders:
+#    zero_dates: fail
+#    invalid_json: wrap
+#    sanitize: fail
+#    # only the rows that match this condition of the source are read, no
+#    # projection (and no CREATE privilege on the source) needed
+#    where: created_at >= NOW() - INTERVAL 2 YEAR
+#    columns:
+#      shipped_at:
+#        zero_dates: "null"
+#      customer_name:
+#        # UTF-8 that was stored in a latin1 column (Ã© instead of é), the
+#        # detect-encoding command reports columns that look like this
+#        repair_encoding: true
+#      cust_nm:
+#        # overrides the naming policy
+#        rename: customer_name_short
+#      price:
+#        # the postgres type of the column, instead of the one derived
+#        type: numeric(12,2)
+#      uuid_bin:
+#        # read with an expression of the source instead, the result is
+#        # converted to the given postgres type
+#        select: LOWER(INSERT(INSERT(INSERT(INSERT(HEX(uuid_bin), 9, 0, '-'), 14, 0, '-'), 19, 0, '-'), 24, 0, '-'))
+#        type: uuid
+#      email:
+#        # replace the values: null, constant (by mask_value, which has to
+#        # suit the column), hash (integers are permuted, so keys stay unique
+#        # and join with columns of the same type), email, phone and name
+#        # (fakes in the same format, cut to fit the column) or shift_date
+#        # (all dates move by the same number of days)
+#        mask: email
+#      notes:
+#        mask: constant
+#        mask_value: redacted
+#      legacy_flags:
+#        # left out of the destination
+#        drop: true
+#    # columns that only exist in the destination, filled in with either a
+#    # constant value or an expression evaluated by postgres
+#    add_columns:
+#      - name: source_system
+#        type: text
+#        value: legacy_shop
+#      - name: migrated_at
+#        type: timestamptz
+#        expression: now()
+
+# if timezone is true, TIMESTAMP columns become timestamp with time zone
+# and their values are converted from the mysql session time zone,
+# otherwise they are copied as naive timestamps
+timezone: true
+
+# DATETIME columns have no time zone and stay naive timestamps, unless a
+# zone is given here, in which case they become timestamp with time zone
+# datetime_zone: Europe/Brussels
 `
 
 type GenerateConfigCommand struct {
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/barnettzqg/gomig/db/common"
+)
+
+/* this file deals with looking at the actual data of the source tables to
+ * correct the types that were derived from the column definitions, which
+ * can be too optimistic (tinyint as bool). */
+
+/* whether the type derived for col depends on what the data looks like */
+func needsProfile(col *common.Column) bool {
+	if col.DstType != "" {
+		/* declared in the config */
+		return false
+	}
+	switch col.Type.Name {
+	case common.TypeBool:
+		/* tinyint(1) is only conventionally a boolean, it can hold up to 127 */
+		return strings.HasPrefix(col.RawType, "tinyint")
+	}
+	return false
+}
+
+/* scans the columns whose type is uncertain and corrects their type
+ * according to the data, warning when the data and the declaration
+ * disagree */
+func profileTables(r common.Reader, tables []*common.Table) {
+	for _, table := range tables {
+		columns := make([]*common.Column, 0, len(table.Columns))
+		for _, col := range table.Columns {
+			if needsProfile(col) {
+				columns = append(columns, col)
+			}
+		}
+		if len(columns) == 0 {
+			continue
+		}
+
+		if VERBOSE {
+			log.Printf("profile: scanning %v column(s) of table %v\n", len(columns), table.Name)
+		}
+
+		profiles, err := r.Profile(table, columns)
+		if err != nil {
+			log.Println("profile: could not profile table", table.Name, "error:", err)
+			continue
+		}
+
+		for _, p := range profiles {
+			applyProfile(p)
+		}
+	}
+}
+
+func applyProfile(p *common.Profile) {
+	col := p.Column
+
+	if col.Type.Name != common.TypeBool || (isBoolean(p.Min) && isBoolean(p.Max)) {
+		return
+	}
+
+	log.Printf("WARNING: profile: %v.%v is declared as %v but has values from %v to %v "+
+		"(%v distinct), migrating it as smallint instead of boolean\n",
+		col.TableName, col.Name, col.RawType, p.Min.String, p.Max.String, p.Distinct)
+	col.Type = common.IntType(common.TypeSmall)
+}
+
+/* NULL (no values at all), 0 and 1 are fine for a boolean */
+func isBoolean(val sql.NullString) bool {
+	if !val.Valid {
+		return true
+	}
+	n, err := strconv.Atoi(val.String)
+	return err == nil && (n == 0 || n == 1)
+}